@@ -0,0 +1,124 @@
+package ftp
+
+import (
+	"io"
+	"net"
+	"net/textproto"
+	"time"
+)
+
+// Telnet commands sent before ABOR, see RFC 854
+const (
+	telnetIAC = 255 // Interpret As Command
+	telnetIP  = 244 // Interrupt Process
+	telnetDM  = 242 // Data Mark, the Synch signal
+)
+
+// abortGracePeriod is the time to wait for the replies that some servers
+// omit after ABOR, once the first reply was received.
+const abortGracePeriod = time.Second
+
+// sourceReader records the error returned by the io.Reader of an upload,
+// to tell it apart from the errors of the data connection.
+type sourceReader struct {
+	io.Reader
+	err error
+}
+
+func (r *sourceReader) Read(buf []byte) (int, error) {
+	n, err := r.Reader.Read(buf)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+// abortUpload stops an upload which failed or was cancelled. When the
+// context of the operation is done, the transfer is aborted by the context
+// recovery, otherwise it is aborted right away.
+func (c *ServerConn) abortUpload(conn net.Conn, srcErr, copyErr error) error {
+	if c.isInterrupted() {
+		return copyErr
+	}
+
+	c.setDataConn(nil)
+	if err := c.abort(conn); err != nil {
+		return err
+	}
+	return srcErr
+}
+
+// sendAbort sends the ABOR command preceded by the Telnet "Interrupt
+// Process" and "Synch" signals, as described in RFC 959 section 4.1.3.
+//
+// The Synch signal is sent as TCP urgent data so that servers busy with the
+// transfer notice it. Over TLS, or when urgent data is not available, the
+// plain ABOR command is sent.
+func (c *ServerConn) sendAbort() error {
+	if tcpConn, ok := c.netConn.(*net.TCPConn); ok {
+		if err := sendUrgent(tcpConn, []byte{telnetIAC, telnetIP, telnetIAC}); err == nil {
+			if err := c.conn.W.WriteByte(telnetDM); err != nil {
+				return err
+			}
+		}
+	}
+
+	return c.sendCmd("ABOR")
+}
+
+// abort stops the in-flight transfer with ABOR, closes its data connection
+// and reads the replies to the transfer and to ABOR, so that the control
+// connection can be used again.
+//
+// Servers usually reply 426 to the transfer then 226 to ABOR, or 226 twice
+// if the transfer was complete, but some of them only send one reply: once
+// a reply is received, the others are only waited for abortGracePeriod.
+func (c *ServerConn) abort(dataConn io.Closer) error {
+	err := c.sendAbort()
+	_ = dataConn.Close()
+	if err != nil {
+		return err
+	}
+
+	code, msg, err := c.readResponse(-1)
+	if err != nil {
+		return err
+	}
+
+	for c.pendingReplies() > 0 {
+		if err = c.netConn.SetReadDeadline(time.Now().Add(abortGracePeriod)); err != nil {
+			return err
+		}
+
+		// The timeout does not break the connection, unlike in readResponse
+		c.ioMu.Lock()
+		code, msg, err = c.conn.ReadResponse(-1)
+		c.ioMu.Unlock()
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			c.mu.Lock()
+			c.pending = nil
+			c.mu.Unlock()
+			break
+		}
+
+		_, ok := err.(*textproto.Error)
+		c.replied(ok || err == nil, code, err)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = c.netConn.SetReadDeadline(time.Time{}); err != nil {
+		return err
+	}
+
+	// ABOR itself may be rejected, but the transfer is over anyway
+	switch {
+	case code < 400, code == StatusTransfertAborted, code == StatusActionAborted:
+		return nil
+	case code == StatusBadCommand, code == StatusNotImplemented:
+		return nil
+	}
+
+	return command{name: "ABOR"}.error(code, msg)
+}
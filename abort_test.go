@@ -0,0 +1,101 @@
+package ftp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseAbort(t *testing.T) {
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second))
+
+	r, err := c.Retr("big-file")
+	require.NoError(t, err)
+
+	buf := make([]byte, 10)
+	_, err = io.ReadFull(r, buf)
+	assert.NoError(t, err)
+
+	assert.NoError(t, r.Abort())
+	assert.NoError(t, r.Close())
+
+	// the control connection is in sync
+	size, err := c.FileSize("magic-file")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), size)
+
+	closeConn(t, mock, c, []string{"EPSV", "RETR", "ABOR", "SIZE"})
+}
+
+func TestRetrContextCanceled(t *testing.T) {
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r, err := c.RetrContext(ctx, "big-file")
+	require.NoError(t, err)
+
+	buf := make([]byte, 10)
+	_, err = io.ReadFull(r, buf)
+	assert.NoError(t, err)
+
+	cancel()
+	_, err = io.Copy(ioutil.Discard, r)
+	assert.Error(t, err)
+	assert.Equal(t, context.Canceled, r.Close())
+
+	assert.NoError(t, c.NoOp())
+
+	closeConn(t, mock, c, []string{"EPSV", "RETR", "ABOR", "NOOP"})
+}
+
+type failingReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *failingReader) Read(buf []byte) (int, error) {
+	n, err := r.r.Read(buf)
+	if err == io.EOF {
+		err = r.err
+	}
+	return n, err
+}
+
+func TestStorAbortOnReaderError(t *testing.T) {
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second))
+
+	errSource := errors.New("source failed")
+	err := c.Stor("test", &failingReader{r: strings.NewReader(testData), err: errSource})
+	assert.Equal(t, errSource, err)
+
+	assert.NoError(t, c.NoOp())
+
+	closeConn(t, mock, c, []string{"EPSV", "STOR", "ABOR", "NOOP"})
+}
+
+func TestResponseAbortSingleReply(t *testing.T) {
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second))
+
+	r, err := c.Retr("big-file-426")
+	require.NoError(t, err)
+
+	// the server does not reply 226 after 426
+	assert.NoError(t, r.Abort())
+	assert.False(t, c.isBroken())
+	assert.Equal(t, 0, c.pendingReplies())
+
+	size, err := c.FileSize("magic-file")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), size)
+
+	closeConn(t, mock, c, []string{"EPSV", "RETR", "ABOR", "SIZE"})
+}
@@ -0,0 +1,104 @@
+package ftp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+)
+
+// AtomicOption represents an option of StorAtomic
+type AtomicOption struct {
+	setup func(ao *atomicOptions)
+}
+
+// atomicOptions contains all the options set by AtomicOption.setup
+type atomicOptions struct {
+	tempName string
+	unique   bool
+}
+
+// AtomicWithTempName returns an AtomicOption that configures the name of the
+// temporary file, in the directory of the destination. The last "*" of the
+// pattern is replaced by the name of the destination.
+// The default is ".*.part".
+func AtomicWithTempName(pattern string) AtomicOption {
+	return AtomicOption{func(ao *atomicOptions) {
+		ao.tempName = pattern
+	}}
+}
+
+// AtomicWithUniqueName returns an AtomicOption that configures whether the
+// temporary file is stored with StorUnique, under a name chosen by the server
+// in the current directory, instead of AtomicWithTempName.
+func AtomicWithUniqueName(enabled bool) AtomicOption {
+	return AtomicOption{func(ao *atomicOptions) {
+		ao.unique = enabled
+	}}
+}
+
+func newAtomicOptions(options []AtomicOption) (*atomicOptions, error) {
+	ao := &atomicOptions{
+		tempName: ".*.part",
+	}
+	for _, option := range options {
+		option.setup(ao)
+	}
+
+	if strings.Contains(ao.tempName, "/") {
+		return nil, errors.New("ftp: the temporary name must not contain /")
+	}
+	return ao, nil
+}
+
+// tempPath returns the path of the temporary file for the destination
+func (ao *atomicOptions) tempPath(path string) string {
+	dir, name := splitPath(path)
+	pattern := ao.tempName
+	if i := strings.LastIndexByte(pattern, '*'); i >= 0 {
+		return dir + pattern[:i] + name + pattern[i+1:]
+	}
+	return dir + pattern
+}
+
+// StorAtomic stores the content of the io.Reader like Stor, but the data is
+// first uploaded to a temporary file, which is renamed to path once the
+// transfer succeeded. Thus other clients never see a partial file at path.
+//
+// The temporary file is deleted if the transfer or the rename fails.
+// The server must allow Rename to replace an existing file at path.
+func (c *ServerConn) StorAtomic(path string, r io.Reader, options ...AtomicOption) error {
+	return c.StorAtomicContext(context.Background(), path, r, options...)
+}
+
+// StorAtomicContext is like StorAtomic but the transfer is interrupted when
+// ctx is done.
+func (c *ServerConn) StorAtomicContext(ctx context.Context, path string, r io.Reader, options ...AtomicOption) error {
+	ao, err := newAtomicOptions(options)
+	if err != nil {
+		return err
+	}
+
+	var tmp string
+	if ao.unique {
+		tmp, err = c.StorUniqueContext(ctx, r)
+	} else {
+		tmp = ao.tempPath(path)
+		err = c.StorFromContext(ctx, tmp, r, 0)
+	}
+	if err == nil {
+		err = c.RenameContext(ctx, tmp, path)
+	}
+	if err != nil && tmp != "" {
+		c.removeTemp(tmp)
+	}
+	return err
+}
+
+// removeTemp deletes the temporary file of a failed upload, if the control
+// connection can still be used
+func (c *ServerConn) removeTemp(tmp string) {
+	if !c.isBroken() {
+		_ = c.Delete(tmp)
+	}
+}
@@ -0,0 +1,65 @@
+package ftp
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorAtomic(t *testing.T) {
+	debug := &bytes.Buffer{}
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second), DialWithDebugOutput(debug))
+
+	err := c.StorAtomic("dir/file", bytes.NewBufferString(testData))
+	require.NoError(t, err)
+	assert.Equal(t, testData, mock.fileCont.String())
+
+	closeConn(t, mock, c, []string{"EPSV", "STOR", "RNFR", "RNTO"})
+	assert.Contains(t, debug.String(), "STOR dir/.file.part\r\n")
+	assert.Contains(t, debug.String(), "RNFR dir/.file.part\r\n")
+	assert.Contains(t, debug.String(), "RNTO dir/file\r\n")
+}
+
+func TestStorAtomicRenameFailed(t *testing.T) {
+	debug := &bytes.Buffer{}
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second), DialWithDebugOutput(debug))
+
+	err := c.StorAtomic("read-only-file", bytes.NewBufferString(testData), AtomicWithTempName("*.tmp"))
+	var ftpErr *Error
+	require.True(t, errors.As(err, &ftpErr))
+	assert.Equal(t, "RNTO", ftpErr.Command)
+	assert.Equal(t, 553, ftpErr.Err.Code)
+
+	// the temporary file is removed
+	closeConn(t, mock, c, []string{"EPSV", "STOR", "RNFR", "RNTO", "DELE"})
+	assert.Contains(t, debug.String(), "DELE read-only-file.tmp\r\n")
+}
+
+func TestAtomicTempPath(t *testing.T) {
+	ao, err := newAtomicOptions(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "/a/.b.part", ao.tempPath("/a/b"))
+	assert.Equal(t, ".b.part", ao.tempPath("b"))
+
+	ao, err = newAtomicOptions([]AtomicOption{AtomicWithTempName("upload-tmp")})
+	require.NoError(t, err)
+	assert.Equal(t, "/a/upload-tmp", ao.tempPath("/a/b"))
+
+	_, err = newAtomicOptions([]AtomicOption{AtomicWithTempName("../*")})
+	assert.Error(t, err)
+}
+
+func TestStorAtomicUniqueName(t *testing.T) {
+	debug := &bytes.Buffer{}
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second), DialWithDebugOutput(debug))
+
+	err := c.StorAtomic("file", bytes.NewBufferString(testData), AtomicWithUniqueName(true))
+	require.NoError(t, err)
+
+	closeConn(t, mock, c, []string{"EPSV", "STOU", "RNFR", "RNTO"})
+	assert.Contains(t, debug.String(), "RNFR stou-file\r\n")
+}
@@ -2,13 +2,17 @@ package ftp
 
 import (
 	"bytes"
+	"errors"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/textproto"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const (
@@ -17,18 +21,26 @@ const (
 )
 
 func TestConnPASV(t *testing.T) {
-	testConn(t, true)
+	testConn(t, DialWithDisabledEPSV(true))
 }
 
 func TestConnEPSV(t *testing.T) {
-	testConn(t, false)
+	testConn(t, DialWithDisabledEPSV(false))
 }
 
-func testConn(t *testing.T, disableEPSV bool) {
+func TestConnActive(t *testing.T) {
+	testConn(t, DialWithActiveMode(""))
+}
+
+func TestConnActivePortRange(t *testing.T) {
+	testConn(t, DialWithActiveMode("127.0.0.1"), DialWithActivePortRange(40000, 40100))
+}
+
+func testConn(t *testing.T, options ...DialOption) {
 
-	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second), DialWithDisabledEPSV(disableEPSV))
+	mock, c := openConn(t, "127.0.0.1", append([]DialOption{DialWithTimeout(5 * time.Second)}, options...)...)
 
-	err := c.Login("anonymous", "anonymous")
+	err := login(c, "anonymous", "anonymous")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -184,7 +196,8 @@ func testConn(t *testing.T, disableEPSV bool) {
 
 	err = c.Logout()
 	if err != nil {
-		if protoErr := err.(*textproto.Error); protoErr != nil {
+		var protoErr *textproto.Error
+		if errors.As(err, &protoErr) {
 			if protoErr.Code != StatusNotImplemented {
 				t.Error(err)
 			}
@@ -249,7 +262,7 @@ func TestWrongLogin(t *testing.T) {
 	}
 	defer c.Quit()
 
-	err = c.Login("zoo2Shia", "fei5Yix9")
+	err = login(c, "zoo2Shia", "fei5Yix9")
 	if err == nil {
 		t.Fatal("expected error, got nil")
 	}
@@ -319,3 +332,99 @@ func TestListCurrentDir(t *testing.T) {
 
 	mock.Wait()
 }
+
+func TestListActiveMode(t *testing.T) {
+	mock, c := openConn(t, "127.0.0.1", DialWithActiveMode(""))
+
+	entries, err := c.List("")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	closeConn(t, mock, c, []string{"EPRT", "LIST"})
+}
+
+func TestListActiveModePortFallback(t *testing.T) {
+	mock, c := openConn(t, "127.0.0.1", DialWithActiveMode("127.0.0.2"))
+
+	for i := 0; i < 2; i++ {
+		entries, err := c.List("")
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+	}
+
+	// EPRT is not sent again once refused
+	closeConn(t, mock, c, []string{"EPRT", "PORT", "LIST", "PORT", "LIST"})
+}
+
+func TestRetrActiveModeNoConnection(t *testing.T) {
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(200*time.Millisecond), DialWithActiveMode("127.0.0.3"))
+
+	// the server replies 150 then 425 without connecting
+	_, err := c.Retr("data-file")
+	assert.Error(t, err)
+	assert.False(t, c.isBroken())
+	assert.Equal(t, 0, c.pendingReplies())
+
+	assert.NoError(t, c.NoOp())
+
+	closeConn(t, mock, c, []string{"EPRT", "RETR", "ABOR", "NOOP"})
+}
+
+func TestAcceptDataConnFromServer(t *testing.T) {
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second))
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	// a connection from another host is refused
+	dialer := &net.Dialer{LocalAddr: &net.TCPAddr{IP: net.ParseIP("127.0.0.2")}}
+	intruder, err := dialer.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer intruder.Close()
+	server, err := net.Dial("tcp", l.Addr().String())
+	require.NoError(t, err)
+	defer server.Close()
+	_, err = server.Write([]byte(testData))
+	require.NoError(t, err)
+
+	conn, err := c.acceptDataConn(l)
+	require.NoError(t, err)
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+	buf := make([]byte, len(testData))
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(t, err)
+	assert.Equal(t, testData, string(buf))
+	require.NoError(t, conn.Close())
+
+	_, err = intruder.Read(buf)
+	assert.Error(t, err)
+
+	c.setDataConn(nil)
+	closeConn(t, mock, c, nil)
+}
+
+func TestStorUnique(t *testing.T) {
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second))
+
+	name, err := c.StorUnique(bytes.NewBufferString(testData))
+	assert.NoError(t, err)
+	assert.Equal(t, "stou-file", name)
+	assert.Equal(t, testData, mock.fileCont.String())
+
+	closeConn(t, mock, c, []string{"EPSV", "STOU"})
+}
+
+func TestParseUniqueName(t *testing.T) {
+	for msg, name := range map[string]string{
+		"FILE: stou.123": "stou.123",
+		"Transfer complete (unique file name:stou.123).":               "stou.123",
+		"Transfer complete (unique name: stou.123)":                    "stou.123",
+		"Opening BINARY mode data connection for ftp1.tmp.":            "ftp1.tmp",
+		"Opening BINARY mode data connection for 'ftp1.tmp' (0 bytes)": "ftp1.tmp",
+		"File successfully transferred\n226 FILE: stou.123":            "stou.123",
+		"Transfer complete.": "",
+		"Ok to send data.":   "",
+	} {
+		assert.Equal(t, name, parseUniqueName(msg), msg)
+	}
+}
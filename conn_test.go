@@ -11,6 +11,7 @@ import (
 	"strings"
 	"sync"
 	"testing"
+	"time"
 )
 
 type ftpMock struct {
@@ -22,9 +23,36 @@ type ftpMock struct {
 	rest     int
 	fileCont *bytes.Buffer
 	dataConn *mockDataConn
+	transfer chan struct{} // closed when the transfer of big-file ends
+	only426  bool          // ABOR is only answered by 426, for big-file-426
+	noDial   bool          // the client announced 127.0.0.3, which is not dialed
+	failed   bool          // the transfer of flaky-file failed once
 	sync.WaitGroup
 }
 
+// mirrorListings are the listings of the tree returned by the mock under /mirror
+var mirrorListings = map[string]string{
+	"/mirror": "drwxr-xr-x   2 ftp      wheel        4096 Jan 29  2020 dir\r\n" +
+		"-rw-r--r--   1 ftp      wheel          14 Jan 29  2020 file\r\n" +
+		"-rw-r--r--   1 ftp      wheel          14 Jan 29  2020 notes.tmp\r\n",
+	"/mirror/dir": "-rw-r--r--   1 ftp      wheel          14 Jan 29  2020 sub-file\r\n",
+
+	// The tree walked by the tests of Pool.Walk, the listing of denied fails
+	"/walk": "drwxr-xr-x   2 ftp      wheel        4096 Jan 29  2020 b\r\n" +
+		"drwxr-xr-x   2 ftp      wheel        4096 Jan 29  2020 a\r\n" +
+		"drwxr-xr-x   2 ftp      wheel        4096 Jan 29  2020 denied\r\n" +
+		"-rw-r--r--   1 ftp      wheel          14 Jan 29  2020 file\r\n",
+	"/walk/a": "-rw-r--r--   1 ftp      wheel          14 Jan 29  2020 a1\r\n" +
+		"drwxr-xr-x   2 ftp      wheel        4096 Jan 29  2020 sub\r\n",
+	"/walk/a/sub": "-rw-r--r--   1 ftp      wheel          14 Jan 29  2020 s1\r\n",
+	"/walk/b": "-rw-r--r--   1 ftp      wheel          14 Jan 29  2020 b2\r\n" +
+		"-rw-r--r--   1 ftp      wheel          14 Jan 29  2020 b1\r\n",
+
+	// The listing of /broken/a breaks the control connection
+	"/broken": "drwxr-xr-x   2 ftp      wheel        4096 Jan 29  2020 a\r\n" +
+		"drwxr-xr-x   2 ftp      wheel        4096 Jan 29  2020 b\r\n",
+}
+
 // newFtpMock returns a mock implementation of a FTP server
 // For simplication, a mock instance only accepts a signle connection and terminates afer
 func newFtpMock(t *testing.T, address string) (*ftpMock, error) {
@@ -66,7 +94,16 @@ func (mock *ftpMock) listen(t *testing.T) {
 	mock.proto.Writer.PrintfLine("220 FTP Server ready.")
 
 	for {
-		fullCommand, _ := mock.proto.ReadLine()
+		fullCommand, err := mock.proto.ReadLine()
+		if err != nil {
+			// the client closed the connection
+			return
+		}
+
+		// Skip the Telnet signals sent before ABOR
+		if i := strings.Index(fullCommand, "ABOR"); i > 0 {
+			fullCommand = fullCommand[i:]
+		}
 		mock.lastFull = fullCommand
 
 		cmdParts := strings.Split(fullCommand, " ")
@@ -97,7 +134,11 @@ func (mock *ftpMock) listen(t *testing.T) {
 		case "DELE":
 			mock.proto.Writer.PrintfLine("250 File successfully removed.")
 		case "MKD":
-			mock.proto.Writer.PrintfLine("257 Directory successfully created.")
+			if mirrorListings[cmdParts[1]] != "" {
+				mock.proto.Writer.PrintfLine("550 Create directory operation failed.")
+			} else {
+				mock.proto.Writer.PrintfLine("257 Directory successfully created.")
+			}
 		case "RMD":
 			if cmdParts[1] == "missing-dir" {
 				mock.proto.Writer.PrintfLine("550 No such file or directory")
@@ -111,9 +152,38 @@ func (mock *ftpMock) listen(t *testing.T) {
 		case "SIZE":
 			if cmdParts[1] == "magic-file" {
 				mock.proto.Writer.PrintfLine("213 42")
+			} else if cmdParts[1] == "slow-file" {
+				time.Sleep(200 * time.Millisecond)
+				mock.proto.Writer.PrintfLine("213 42")
+			} else if (cmdParts[1] == "data-file" || cmdParts[1] == "flaky-file") && mock.fileCont != nil {
+				mock.proto.Writer.PrintfLine("213 %d", mock.fileCont.Len())
 			} else {
 				mock.proto.Writer.PrintfLine("550 Could not get file size.")
 			}
+		case "MDTM":
+			if len(cmdParts) == 3 {
+				mock.proto.Writer.PrintfLine("213 File modification time set.")
+			} else if cmdParts[1] == "magic-file" || cmdParts[1] == "data-file" {
+				mock.proto.Writer.PrintfLine("213 20201213202400.123")
+			} else {
+				mock.proto.Writer.PrintfLine("550 Could not get file modification time.")
+			}
+		case "MFMT":
+			mock.proto.Writer.PrintfLine("213 Modify=%s; %s", cmdParts[1], cmdParts[2])
+		case "MFF":
+			mock.proto.Writer.PrintfLine("213 %s %s", cmdParts[1], cmdParts[2])
+		case "HASH":
+			mock.proto.Writer.PrintfLine("213 SHA-256 0-41 A6C39E3B0A5AAB4B4DD1F5A5B6ADC9CB75327E8A1C8E54E4C4D9F03D2BE9BC7E %s", cmdParts[1])
+		case "RANG":
+			mock.proto.Writer.PrintfLine("350 Restarting at %s. Ending byte %s", cmdParts[1], cmdParts[2])
+		case "XMD5":
+			mock.proto.Writer.PrintfLine("250 B1946AC92492D2347C6235B4D2611184")
+		case "MLST":
+			if cmdParts[1] == "magic-file" {
+				mock.proto.Writer.PrintfLine("250-Listing magic-file\r\n type=file;size=42;modify=20201213202400; /incoming/magic-file\r\n250 End")
+			} else {
+				mock.proto.Writer.PrintfLine("550 %s: No such file or directory", cmdParts[1])
+			}
 		case "PASV":
 			p, err := mock.listenDataConn()
 			if err != nil {
@@ -132,6 +202,44 @@ func (mock *ftpMock) listen(t *testing.T) {
 				break
 			}
 			mock.proto.Writer.PrintfLine("229 Entering Extended Passive Mode (|||%d|)", p)
+		case "EPRT":
+			// EPRT |1|127.0.0.1|1234|
+			fields := strings.Split(cmdParts[1], "|")
+			if len(fields) != 5 {
+				mock.proto.Writer.PrintfLine("501 Syntax error in parameters.")
+				break
+			}
+			// EPRT is not supported for the clients listening on 127.0.0.2
+			if fields[2] == "127.0.0.2" {
+				mock.proto.Writer.PrintfLine("500 EPRT not understood.")
+				break
+			}
+			// the transfers fail after 150 for the clients listening on 127.0.0.3
+			if fields[2] == "127.0.0.3" {
+				mock.noDial = true
+				mock.proto.Writer.PrintfLine("200 EPRT command successful.")
+				break
+			}
+			if err := mock.dialDataConn(net.JoinHostPort(fields[2], fields[3])); err != nil {
+				mock.proto.Writer.PrintfLine("425 %s.", err)
+				break
+			}
+			mock.proto.Writer.PrintfLine("200 EPRT command successful.")
+		case "PORT":
+			// PORT 127,0,0,1,4,210
+			fields := strings.Split(cmdParts[1], ",")
+			if len(fields) != 6 {
+				mock.proto.Writer.PrintfLine("501 Syntax error in parameters.")
+				break
+			}
+			p1, _ := strconv.Atoi(fields[4])
+			p2, _ := strconv.Atoi(fields[5])
+			host := strings.Join(fields[:4], ".")
+			if err := mock.dialDataConn(net.JoinHostPort(host, strconv.Itoa(p1*256+p2))); err != nil {
+				mock.proto.Writer.PrintfLine("425 %s.", err)
+				break
+			}
+			mock.proto.Writer.PrintfLine("200 PORT command successful.")
 		case "STOR":
 			if mock.dataConn == nil {
 				mock.proto.Writer.PrintfLine("425 Unable to build data connection: Connection refused")
@@ -139,6 +247,13 @@ func (mock *ftpMock) listen(t *testing.T) {
 			}
 			mock.proto.Writer.PrintfLine("150 please send")
 			mock.recvDataConn(false)
+		case "STOU":
+			if mock.dataConn == nil {
+				mock.proto.Writer.PrintfLine("425 Unable to build data connection: Connection refused")
+				break
+			}
+			mock.proto.Writer.PrintfLine("150 FILE: stou-file")
+			mock.recvDataConn(false)
 		case "APPE":
 			if mock.dataConn == nil {
 				mock.proto.Writer.PrintfLine("425 Unable to build data connection: Connection refused")
@@ -153,8 +268,22 @@ func (mock *ftpMock) listen(t *testing.T) {
 			}
 
 			mock.dataConn.Wait()
+			if len(cmdParts) > 1 && cmdParts[1] == "/walk/denied" {
+				mock.proto.Writer.PrintfLine("550 Permission denied")
+				mock.closeDataConn()
+				break
+			}
+			if len(cmdParts) > 1 && cmdParts[1] == "/broken/a" {
+				mock.proto.Writer.PrintfLine("421 Service not available, closing control connection")
+				mock.closeDataConn()
+				break
+			}
 			mock.proto.Writer.PrintfLine("150 Opening ASCII mode data connection for file list")
-			mock.dataConn.conn.Write([]byte("-rw-r--r--   1 ftp      wheel           0 Jan 29 10:29 lo"))
+			if len(cmdParts) > 1 && mirrorListings[strings.TrimSuffix(cmdParts[1], "/")] != "" {
+				mock.dataConn.conn.Write([]byte(mirrorListings[strings.TrimSuffix(cmdParts[1], "/")]))
+			} else {
+				mock.dataConn.conn.Write([]byte("-rw-r--r--   1 ftp      wheel           0 Jan 29 10:29 lo"))
+			}
 			mock.proto.Writer.PrintfLine("226 Transfer complete")
 			mock.closeDataConn()
 		case "NLST":
@@ -169,13 +298,45 @@ func (mock *ftpMock) listen(t *testing.T) {
 			mock.proto.Writer.PrintfLine("226 Transfer complete")
 			mock.closeDataConn()
 		case "RETR":
+			if mock.dataConn == nil && mock.noDial {
+				mock.noDial = false
+				mock.proto.Writer.PrintfLine("150 Opening BINARY mode data connection for %s", cmdParts[1])
+				mock.proto.Writer.PrintfLine("425 Can't open data connection.")
+				break
+			}
 			if mock.dataConn == nil {
 				mock.proto.Writer.PrintfLine("425 Unable to build data connection: Connection refused")
 				break
 			}
 
 			mock.dataConn.Wait()
-			mock.proto.Writer.PrintfLine("150 Opening ASCII mode data connection for file list")
+			if cmdParts[1] == "big-file" || cmdParts[1] == "big-file-426" {
+				mock.proto.Writer.PrintfLine("150 Opening BINARY mode data connection for %s", cmdParts[1])
+				// the transfer runs until it is aborted
+				mock.transfer = make(chan struct{})
+				mock.only426 = cmdParts[1] == "big-file-426"
+				go func(conn net.Conn, done chan struct{}) {
+					defer close(done)
+					buf := make([]byte, 4096)
+					for {
+						if _, err := conn.Write(buf); err != nil {
+							return
+						}
+					}
+				}(mock.dataConn.conn, mock.transfer)
+				break
+			}
+			mock.proto.Writer.PrintfLine("150 Opening BINARY mode data connection for %s (%d bytes)", cmdParts[1], mock.fileCont.Len())
+			if cmdParts[1] == "flaky-file" && !mock.failed {
+				// the first transfer stops halfway
+				data := mock.fileCont.Bytes()[mock.rest:]
+				mock.dataConn.conn.Write(data[:len(data)/2])
+				mock.rest = 0
+				mock.failed = true
+				mock.proto.Writer.PrintfLine("426 Connection closed; transfer aborted")
+				mock.closeDataConn()
+				break
+			}
 			mock.dataConn.conn.Write(mock.fileCont.Bytes()[mock.rest:])
 			mock.rest = 0
 			mock.proto.Writer.PrintfLine("226 Transfer complete")
@@ -183,7 +344,11 @@ func (mock *ftpMock) listen(t *testing.T) {
 		case "RNFR":
 			mock.proto.Writer.PrintfLine("350 File or directory exists, ready for destination name")
 		case "RNTO":
-			mock.proto.Writer.PrintfLine("250 Rename successful")
+			if cmdParts[1] == "read-only-file" {
+				mock.proto.Writer.PrintfLine("553 Could not rename: permission denied")
+			} else {
+				mock.proto.Writer.PrintfLine("250 Rename successful")
+			}
 		case "REST":
 			if len(cmdParts) != 2 {
 				mock.proto.Writer.PrintfLine("500 wrong number of arguments")
@@ -196,6 +361,18 @@ func (mock *ftpMock) listen(t *testing.T) {
 			}
 			mock.rest = rest
 			mock.proto.Writer.PrintfLine("350 Restarting at %s. Send STORE or RETRIEVE to initiate transfer", cmdParts[1])
+		case "ABOR":
+			if mock.transfer == nil {
+				mock.proto.Writer.PrintfLine("225 No transfer to abort.")
+				break
+			}
+			mock.closeDataConn()
+			<-mock.transfer
+			mock.transfer = nil
+			mock.proto.Writer.PrintfLine("426 Transfer aborted.")
+			if !mock.only426 {
+				mock.proto.Writer.PrintfLine("226 Abort successful.")
+			}
 		case "NOOP":
 			mock.proto.Writer.PrintfLine("200 NOOP ok.")
 		case "OPTS":
@@ -205,6 +382,8 @@ func (mock *ftpMock) listen(t *testing.T) {
 			}
 			if (strings.Join(cmdParts[1:], " ")) == "UTF8 ON" {
 				mock.proto.Writer.PrintfLine("200 OK, UTF-8 enabled")
+			} else if cmdParts[1] == "HASH" {
+				mock.proto.Writer.PrintfLine("200 %s", cmdParts[2])
 			}
 		case "REIN":
 			mock.proto.Writer.PrintfLine("220 Logged out")
@@ -286,9 +465,26 @@ func (mock *ftpMock) listenDataConn() (int64, error) {
 	return p, nil
 }
 
+// dialDataConn connects to the client for an active mode data connection
+func (mock *ftpMock) dialDataConn(addr string) error {
+	mock.closeDataConn()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	mock.dataConn = &mockDataConn{conn: conn}
+	return nil
+}
+
 func (mock *ftpMock) recvDataConn(append bool) {
 	mock.dataConn.Wait()
-	if !append {
+	if !append && mock.rest > 0 {
+		// the upload is resumed
+		mock.fileCont.Truncate(mock.rest)
+		mock.rest = 0
+	} else if !append {
 		mock.fileCont = new(bytes.Buffer)
 	}
 	io.Copy(mock.fileCont, mock.dataConn.conn)
@@ -318,7 +514,7 @@ func openConn(t *testing.T, addr string, options ...DialOption) (*ftpMock, *Serv
 		t.Fatal(err)
 	}
 
-	err = c.Login("anonymous", "anonymous")
+	err = login(c, "anonymous", "anonymous")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -354,3 +550,16 @@ func TestConn6(t *testing.T) {
 	mock, c := openConn(t, "[::1]")
 	closeConn(t, mock, c, nil)
 }
+
+// login authenticates with Auth and completes the session setup with
+// AfterAuth, failing when the server did not log the user in.
+func login(c *ServerConn, user, password string) error {
+	code, err := c.Auth(user, password)
+	if err != nil {
+		return err
+	}
+	if code != StatusLoggedIn {
+		return &textproto.Error{Code: code, Msg: StatusText(code)}
+	}
+	return c.AfterAuth()
+}
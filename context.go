@@ -0,0 +1,367 @@
+package ftp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+)
+
+// aLongTimeAgo is a non-zero time, far in the past, used to interrupt
+// the I/O operations of a connection immediately.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// recoveryTimeout bounds the time spent to resynchronize the control
+// connection after an interruption, unless DialWithTimeout is used.
+const recoveryTimeout = 5 * time.Second
+
+// begin starts an operation which is interrupted when ctx is done, see
+// watchContext. The returned function must be called once the operation is
+// over.
+//
+// With DialWithSerializedCalls, begin waits for the running operation to be
+// over. Otherwise it fails with ErrConnBusy, rather than interleaving the
+// commands and their replies.
+func (c *ServerConn) begin(ctx context.Context) (func(errp *error), error) {
+	if c.calls != nil {
+		select {
+		case c.calls <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	} else if c.pendingReplies() > 0 && !c.isBroken() {
+		return nil, ErrConnBusy
+	}
+
+	stop := c.watchContext(ctx)
+	return func(errp *error) {
+		stop(errp)
+		if c.calls != nil {
+			<-c.calls
+		}
+	}, nil
+}
+
+// run runs op as a single operation, see begin.
+func (c *ServerConn) run(ctx context.Context, op func() error) (err error) {
+	end, err := c.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer end(&err)
+
+	return op()
+}
+
+// watchContext interrupts the I/O operations on the control and data
+// connections when ctx is done. The returned function must be called once
+// the operation is over: if the operation was interrupted, it recovers the
+// control connection and replaces the error pointed by errp with ctx.Err().
+// The control connection is closed if it cannot be recovered.
+func (c *ServerConn) watchContext(ctx context.Context) func(errp *error) {
+	if ctx.Done() == nil {
+		return func(*error) {}
+	}
+
+	c.ctx = ctx
+	stop := make(chan struct{})
+	interrupted := make(chan bool, 1)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.interrupt()
+			interrupted <- true
+		case <-stop:
+			interrupted <- false
+		}
+	}()
+
+	return func(errp *error) {
+		close(stop)
+		c.ctx = nil
+		if !<-interrupted {
+			return
+		}
+
+		if err := c.recover(); err != nil {
+			*errp = fmt.Errorf("%w (connection closed: %v)", ctx.Err(), err)
+		} else if *errp != nil {
+			*errp = ctx.Err()
+		}
+	}
+}
+
+// interrupt sets the deadlines of the control and data connections in the
+// past so that the pending I/O operations fail.
+func (c *ServerConn) interrupt() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.interrupted = true
+	_ = c.netConn.SetDeadline(aLongTimeAgo)
+	if c.dataConn != nil {
+		_ = c.dataConn.SetDeadline(aLongTimeAgo)
+	}
+}
+
+// recover resynchronizes the control connection after an interruption:
+// the in-flight transfer is aborted and the pending replies are read.
+func (c *ServerConn) recover() error {
+	c.mu.Lock()
+	c.interrupted = false
+	dataConn := c.dataConn
+	c.dataConn = nil
+	c.mu.Unlock()
+
+	err := c.resync(dataConn, c.resyncTimeout())
+	if err != nil {
+		c.setBroken()
+		_ = c.conn.Close()
+	}
+
+	return err
+}
+
+// resyncTimeout returns the timeout of the operations which resynchronize
+// the control connection.
+func (c *ServerConn) resyncTimeout() time.Duration {
+	if timeout := c.options.dialer.Timeout; timeout > 0 {
+		return timeout
+	}
+	return recoveryTimeout
+}
+
+func (c *ServerConn) resync(dataConn io.Closer, timeout time.Duration) error {
+	if err := c.netConn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	if dataConn != nil {
+		if err := c.abort(dataConn); err != nil {
+			return err
+		}
+	}
+
+	for c.pendingReplies() > 0 {
+		if _, _, err := c.readResponse(-1); err != nil {
+			return err
+		}
+	}
+
+	return c.netConn.SetDeadline(time.Time{})
+}
+
+// AuthContext is like Auth but the operation is interrupted when ctx is done.
+func (c *ServerConn) AuthContext(ctx context.Context, user, password string) (code int, err error) {
+	err = c.run(ctx, func() error {
+		code, err = c.auth(user, password)
+		return err
+	})
+	return code, err
+}
+
+// AfterAuthContext is like AfterAuth but the operation is interrupted when ctx is done.
+func (c *ServerConn) AfterAuthContext(ctx context.Context) error {
+	return c.run(ctx, c.afterAuth)
+}
+
+// NameListContext is like NameList but the operation is interrupted when ctx is done.
+func (c *ServerConn) NameListContext(ctx context.Context, path string) (entries []string, err error) {
+	err = c.run(ctx, func() error {
+		entries, err = c.nameList(path)
+		return err
+	})
+	return entries, err
+}
+
+// ListContext is like List but the operation is interrupted when ctx is done.
+func (c *ServerConn) ListContext(ctx context.Context, path string) (entries []*Entry, err error) {
+	err = c.run(ctx, func() error {
+		entries, err = c.list(path)
+		return err
+	})
+	return entries, err
+}
+
+// ChangeDirContext is like ChangeDir but the operation is interrupted when ctx is done.
+func (c *ServerConn) ChangeDirContext(ctx context.Context, path string) error {
+	return c.run(ctx, func() error {
+		return c.changeDir(path)
+	})
+}
+
+// ChangeDirToParentContext is like ChangeDirToParent but the operation is
+// interrupted when ctx is done.
+func (c *ServerConn) ChangeDirToParentContext(ctx context.Context) error {
+	return c.run(ctx, c.changeDirToParent)
+}
+
+// CurrentDirContext is like CurrentDir but the operation is interrupted when ctx is done.
+func (c *ServerConn) CurrentDirContext(ctx context.Context) (dir string, err error) {
+	err = c.run(ctx, func() error {
+		dir, err = c.currentDir()
+		return err
+	})
+	return dir, err
+}
+
+// FileSizeContext is like FileSize but the operation is interrupted when ctx is done.
+func (c *ServerConn) FileSizeContext(ctx context.Context, path string) (size int64, err error) {
+	err = c.run(ctx, func() error {
+		size, err = c.fileSize(path)
+		return err
+	})
+	return size, err
+}
+
+// GetTimeContext is like GetTime but the operation is interrupted when ctx is done.
+func (c *ServerConn) GetTimeContext(ctx context.Context, path string) (t time.Time, err error) {
+	err = c.run(ctx, func() error {
+		t, err = c.getTime(path)
+		return err
+	})
+	return t, err
+}
+
+// SetTimeContext is like SetTime but the operation is interrupted when ctx is done.
+func (c *ServerConn) SetTimeContext(ctx context.Context, path string, t time.Time) error {
+	return c.run(ctx, func() error {
+		return c.setTime(path, t)
+	})
+}
+
+// SetFactsContext is like SetFacts but the operation is interrupted when ctx is done.
+func (c *ServerConn) SetFactsContext(ctx context.Context, path string, facts Facts) error {
+	return c.run(ctx, func() error {
+		return c.setFacts(path, facts)
+	})
+}
+
+// HashContext is like Hash but the operation is interrupted when ctx is done.
+func (c *ServerConn) HashContext(ctx context.Context, path string, algo HashAlgo) (hash string, err error) {
+	err = c.run(ctx, func() error {
+		hash, err = c.hash(path, algo, 0, -1)
+		return err
+	})
+	return hash, err
+}
+
+// HashRangeContext is like HashRange but the operation is interrupted when ctx is done.
+func (c *ServerConn) HashRangeContext(ctx context.Context, path string, algo HashAlgo, start, end int64) (hash string, err error) {
+	err = c.run(ctx, func() error {
+		hash, err = c.hash(path, algo, start, end)
+		return err
+	})
+	return hash, err
+}
+
+// StatContext is like Stat but the operation is interrupted when ctx is done.
+func (c *ServerConn) StatContext(ctx context.Context, path string) (entry *Entry, err error) {
+	err = c.run(ctx, func() error {
+		entry, err = c.stat(path)
+		return err
+	})
+	return entry, err
+}
+
+// RetrContext is like Retr but the transfer is interrupted when ctx is done.
+//
+// The context is watched until the returned Response is closed.
+func (c *ServerConn) RetrContext(ctx context.Context, path string) (*Response, error) {
+	return c.RetrFromContext(ctx, path, 0)
+}
+
+// RetrFromContext is like RetrFrom but the transfer is interrupted when ctx is done.
+//
+// The context is watched until the returned Response is closed.
+func (c *ServerConn) RetrFromContext(ctx context.Context, path string, offset uint64) (*Response, error) {
+	end, err := c.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := c.retrFrom(path, offset)
+	if err != nil {
+		end(&err)
+		return nil, err
+	}
+
+	r.end = end
+	return r, nil
+}
+
+// StorContext is like Stor but the transfer is interrupted when ctx is done.
+func (c *ServerConn) StorContext(ctx context.Context, path string, r io.Reader) error {
+	return c.StorFromContext(ctx, path, r, 0)
+}
+
+// StorFromContext is like StorFrom but the transfer is interrupted when ctx is done.
+func (c *ServerConn) StorFromContext(ctx context.Context, path string, r io.Reader, offset uint64) error {
+	return c.run(ctx, func() error {
+		return c.storFrom(path, r, offset)
+	})
+}
+
+// StorUniqueContext is like StorUnique but the transfer is interrupted when
+// ctx is done.
+func (c *ServerConn) StorUniqueContext(ctx context.Context, r io.Reader) (name string, err error) {
+	err = c.run(ctx, func() error {
+		name, err = c.storUnique(r)
+		return err
+	})
+	return name, err
+}
+
+// AppendContext is like Append but the transfer is interrupted when ctx is done.
+func (c *ServerConn) AppendContext(ctx context.Context, path string, r io.Reader) error {
+	return c.run(ctx, func() error {
+		return c.appendFile(path, r)
+	})
+}
+
+// RenameContext is like Rename but the operation is interrupted when ctx is done.
+func (c *ServerConn) RenameContext(ctx context.Context, from, to string) error {
+	return c.run(ctx, func() error {
+		return c.rename(from, to)
+	})
+}
+
+// DeleteContext is like Delete but the operation is interrupted when ctx is done.
+func (c *ServerConn) DeleteContext(ctx context.Context, path string) error {
+	return c.run(ctx, func() error {
+		return c.deleteFile(path)
+	})
+}
+
+// RemoveDirRecurContext is like RemoveDirRecur but the operation is
+// interrupted when ctx is done.
+func (c *ServerConn) RemoveDirRecurContext(ctx context.Context, path string) error {
+	return c.run(ctx, func() error {
+		return c.removeDirRecur(path)
+	})
+}
+
+// MakeDirContext is like MakeDir but the operation is interrupted when ctx is done.
+func (c *ServerConn) MakeDirContext(ctx context.Context, path string) error {
+	return c.run(ctx, func() error {
+		return c.makeDir(path)
+	})
+}
+
+// RemoveDirContext is like RemoveDir but the operation is interrupted when ctx is done.
+func (c *ServerConn) RemoveDirContext(ctx context.Context, path string) error {
+	return c.run(ctx, func() error {
+		return c.removeDir(path)
+	})
+}
+
+// NoOpContext is like NoOp but the operation is interrupted when ctx is done.
+func (c *ServerConn) NoOpContext(ctx context.Context) error {
+	return c.run(ctx, c.noOp)
+}
+
+// LogoutContext is like Logout but the operation is interrupted when ctx is done.
+func (c *ServerConn) LogoutContext(ctx context.Context) error {
+	return c.run(ctx, c.logout)
+}
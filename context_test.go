@@ -0,0 +1,59 @@
+package ftp
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContextInterruptsCommand(t *testing.T) {
+	mock, c := openConn(t, "127.0.0.1")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := c.FileSizeContext(ctx, "slow-file")
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// the late reply must have been consumed
+	size, err := c.FileSize("magic-file")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), size)
+
+	closeConn(t, mock, c, []string{"SIZE", "SIZE"})
+}
+
+func TestContextNotDone(t *testing.T) {
+	mock, c := openConn(t, "127.0.0.1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	entries, err := c.ListContext(ctx, "")
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	size, err := c.FileSizeContext(ctx, "magic-file")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), size)
+
+	closeConn(t, mock, c, []string{"EPSV", "LIST", "SIZE"})
+}
+
+func TestContextAlreadyCanceled(t *testing.T) {
+	mock, c := openConn(t, "127.0.0.1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := c.ListContext(ctx, "")
+	assert.Equal(t, context.Canceled, err)
+
+	// the connection is still usable
+	assert.NoError(t, c.NoOp())
+
+	assert.NoError(t, c.Quit())
+	mock.Wait()
+}
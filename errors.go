@@ -0,0 +1,199 @@
+package ftp
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+)
+
+// The errors below are matched by errors.Is against the *Error returned
+// when the server replies with a negative code.
+var (
+	// ErrNotFound matches the 550 replies: the file is not found or it is
+	// not accessible.
+	ErrNotFound = errors.New("ftp: file not found")
+	// ErrPermissionDenied matches the 550 replies which report a permission
+	// problem and the 532 replies.
+	ErrPermissionDenied = errors.New("ftp: permission denied")
+	// ErrNotLoggedIn matches the 530 and 430 replies.
+	ErrNotLoggedIn = errors.New("ftp: not logged in")
+	// ErrStorageExceeded matches the 452 and 552 replies.
+	ErrStorageExceeded = errors.New("ftp: storage exceeded")
+	// ErrServiceUnavailable matches the 421 replies, after which the server
+	// closes the control connection.
+	ErrServiceUnavailable = errors.New("ftp: service unavailable")
+	// ErrTransferAborted matches the 426 replies.
+	ErrTransferAborted = errors.New("ftp: transfer aborted")
+	// ErrNotSupported matches the 502 and 504 replies. It is also returned
+	// when the server does not advertise the command required by an
+	// operation.
+	ErrNotSupported = errors.New("ftp: command not supported")
+)
+
+// Error is returned when the server replies to a command with an unexpected
+// code. It wraps the *textproto.Error holding the reply.
+type Error struct {
+	Command string // name of the command, such as "RETR"
+	Path    string // path argument of the command, if any
+	Err     *textproto.Error
+}
+
+func (e *Error) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("ftp: %s: %03d %s", e.Command, e.Err.Code, e.Err.Msg)
+	}
+	return fmt.Sprintf("ftp: %s %s: %03d %s", e.Command, e.Path, e.Err.Code, e.Err.Msg)
+}
+
+// Unwrap returns the *textproto.Error holding the reply.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the reply code matches target, one of the errors
+// declared by this package.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.Err.Code == StatusFileUnavailable && !isPermissionMsg(e.Err.Msg)
+	case ErrPermissionDenied:
+		return (e.Err.Code == StatusFileUnavailable && isPermissionMsg(e.Err.Msg)) ||
+			e.Err.Code == StatusStorNeedAccount
+	case ErrNotLoggedIn:
+		return e.Err.Code == StatusNotLoggedIn || e.Err.Code == StatusInvalidCredentials
+	case ErrStorageExceeded:
+		return e.Err.Code == Status452 || e.Err.Code == StatusExceededStorage
+	case ErrServiceUnavailable:
+		return e.Err.Code == StatusNotAvailable
+	case ErrTransferAborted:
+		return e.Err.Code == StatusTransfertAborted
+	case ErrNotSupported:
+		return e.Err.Code == StatusNotImplemented || e.Err.Code == StatusNotImplementedParameter
+	}
+	return false
+}
+
+// Temporary reports whether the reply is a transient negative completion
+// reply (4xx): the command may succeed if it is sent again later.
+// The permanent negative completion replies (5xx) are not temporary.
+func (e *Error) Temporary() bool {
+	return e.Err.Code >= 400 && e.Err.Code < 500
+}
+
+// isPermissionMsg reports whether the message of a 550 reply is about
+// permissions rather than a missing file, as both share the same code.
+func isPermissionMsg(msg string) bool {
+	msg = strings.ToLower(msg)
+	return strings.Contains(msg, "permission") || strings.Contains(msg, "denied") ||
+		strings.Contains(msg, "not allowed")
+}
+
+// command identifies a command sent to the server, to describe its errors
+type command struct {
+	name string
+	path string
+}
+
+// pathCommands are the commands whose argument is a path
+var pathCommands = map[string]bool{
+	"APPE": true,
+	"CWD":  true,
+	"DELE": true,
+	"HASH": true,
+	"LIST": true,
+	"MKD":  true,
+	"MLSD": true,
+	"MDTM": true,
+	"MLST": true,
+	"NLST": true,
+	"RETR": true,
+	"RMD":  true,
+	"RNFR": true,
+	"RNTO": true,
+	"SIZE": true,
+	"STOR": true,
+
+	"XCRC":    true,
+	"XMD5":    true,
+	"XSHA1":   true,
+	"XSHA256": true,
+	"XSHA512": true,
+}
+
+// factCommands are the commands whose argument is a time or facts
+// followed by a path
+var factCommands = map[string]bool{
+	"MFF":  true,
+	"MFMT": true,
+}
+
+// parseCommand returns the name and path of a command line. The other
+// arguments, such as the password of PASS, are not kept.
+func parseCommand(line string) command {
+	name, arg := line, ""
+	if i := strings.IndexByte(line, ' '); i >= 0 {
+		name, arg = line[:i], line[i+1:]
+	}
+	name = strings.ToUpper(name)
+
+	// The MDTM variant setting the time is handled like MFMT
+	if name == "MDTM" && len(arg) > len(timeFormat) && arg[len(timeFormat)] == ' ' {
+		if _, err := time.Parse(timeFormat, arg[:len(timeFormat)]); err == nil {
+			return command{name: name, path: arg[len(timeFormat)+1:]}
+		}
+	}
+
+	switch {
+	case name == "PRET":
+		return command{name: name, path: parseCommand(arg).path}
+	case factCommands[name]:
+		if i := strings.IndexByte(arg, ' '); i >= 0 {
+			return command{name: name, path: arg[i+1:]}
+		}
+	case pathCommands[name]:
+		return command{name: name, path: arg}
+	}
+	return command{name: name}
+}
+
+// error returns the *Error for a negative reply to the command
+func (cmd command) error(code int, msg string) *Error {
+	return &Error{
+		Command: cmd.name,
+		Path:    cmd.path,
+		Err:     &textproto.Error{Code: code, Msg: msg},
+	}
+}
+
+// pathError returns the error of a file system operation, see FS and
+// WritableFS. It matches os.ErrNotExist and os.ErrPermission like
+// ErrNotFound and ErrPermissionDenied.
+func pathError(op, name string, err error) error {
+	return &os.PathError{Op: op, Path: name, Err: &mappedError{err}}
+}
+
+// mappedError makes the errors of the ServerConn match the errors of os
+type mappedError struct {
+	err error
+}
+
+func (e *mappedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *mappedError) Unwrap() error {
+	return e.err
+}
+
+func (e *mappedError) Is(target error) bool {
+	switch target {
+	case os.ErrNotExist:
+		return errors.Is(e.err, ErrNotFound)
+	case os.ErrPermission:
+		return errors.Is(e.err, ErrPermissionDenied)
+	}
+	return false
+}
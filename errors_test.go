@@ -0,0 +1,81 @@
+package ftp
+
+import (
+	"errors"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrorIs(t *testing.T) {
+	tests := []struct {
+		code   int
+		msg    string
+		target error
+	}{
+		{550, "missing-file: No such file or directory", ErrNotFound},
+		{550, "Permission denied.", ErrPermissionDenied},
+		{532, "Need account for storing files.", ErrPermissionDenied},
+		{530, "Login incorrect.", ErrNotLoggedIn},
+		{452, "Insufficient storage space.", ErrStorageExceeded},
+		{552, "Quota exceeded.", ErrStorageExceeded},
+		{421, "Timeout.", ErrServiceUnavailable},
+		{426, "Failure writing network stream.", ErrTransferAborted},
+		{502, "Command not implemented.", ErrNotSupported},
+	}
+
+	all := []error{ErrNotFound, ErrPermissionDenied, ErrNotLoggedIn,
+		ErrStorageExceeded, ErrServiceUnavailable, ErrTransferAborted, ErrNotSupported}
+
+	for _, test := range tests {
+		err := command{name: "RETR", path: "file"}.error(test.code, test.msg)
+		for _, target := range all {
+			assert.Equal(t, target == test.target, errors.Is(err, target), "%d %s: %v", test.code, test.msg, target)
+		}
+	}
+}
+
+func TestErrorTemporary(t *testing.T) {
+	assert.True(t, command{name: "STOR"}.error(451, "Local error.").Temporary())
+	assert.False(t, command{name: "STOR"}.error(553, "Bad file name.").Temporary())
+}
+
+func TestParseCommand(t *testing.T) {
+	assert.Equal(t, command{name: "RETR", path: "dir/file name"}, parseCommand("RETR dir/file name"))
+	assert.Equal(t, command{name: "PASS"}, parseCommand("PASS secret"))
+	assert.Equal(t, command{name: "PRET", path: "file"}, parseCommand("PRET STOR file"))
+	assert.Equal(t, command{name: "NOOP"}, parseCommand("NOOP"))
+	assert.Equal(t, command{name: "MDTM", path: "file"}, parseCommand("MDTM file"))
+	assert.Equal(t, command{name: "MDTM", path: "file"}, parseCommand("MDTM 20201213202400 file"))
+	assert.Equal(t, command{name: "MFMT", path: "file"}, parseCommand("MFMT 20201213202400 file"))
+}
+
+func TestReplyError(t *testing.T) {
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second))
+
+	_, err := c.FileSize("missing-file")
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.Equal(t, "ftp: SIZE missing-file: 550 Could not get file size.", err.Error())
+
+	var ftpErr *Error
+	require.True(t, errors.As(err, &ftpErr))
+	assert.Equal(t, "SIZE", ftpErr.Command)
+	assert.Equal(t, "missing-file", ftpErr.Path)
+	assert.False(t, ftpErr.Temporary())
+
+	var protoErr *textproto.Error
+	require.True(t, errors.As(err, &protoErr))
+	assert.Equal(t, StatusFileUnavailable, protoErr.Code)
+
+	err = c.ChangeDir("missing-dir")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	// the connection is still usable
+	assert.NoError(t, c.NoOp())
+
+	closeConn(t, mock, c, []string{"SIZE", "CWD", "NOOP"})
+}
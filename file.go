@@ -0,0 +1,187 @@
+package ftp
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// defaultReadAhead is the default minimum size of the reads of File
+const defaultReadAhead = 64 * 1024
+
+// OpenOption represents an option of Open
+type OpenOption struct {
+	setup func(oo *openOptions)
+}
+
+// openOptions contains all the options set by OpenOption.setup
+type openOptions struct {
+	readAhead int
+}
+
+// OpenWithReadAhead returns an OpenOption that configures the minimum number
+// of bytes read from the server by each transfer. They are kept in a cache,
+// so that small sequential reads do not open a data connection each.
+// The default is 64 KiB.
+func OpenWithReadAhead(size int) OpenOption {
+	return OpenOption{func(oo *openOptions) {
+		oo.readAhead = size
+	}}
+}
+
+// File is a remote file open for random access, see Open. Each read that
+// misses the cache is a RetrFrom at the right offset, aborted once enough
+// bytes were received.
+//
+// ReadAt is safe for concurrent use, the reads are serialized.
+type File struct {
+	c         *ServerConn
+	path      string
+	size      int64
+	readAhead int
+	offset    int64 // offset of Read and Seek
+
+	mu       sync.Mutex // protects the fields below
+	cache    []byte
+	cacheOff int64
+	closed   bool
+}
+
+// Open returns a File to read the remote file at random offsets. Its size is
+// read once with FileSize.
+//
+// The File uses the ServerConn for each read that misses its cache, which
+// must not happen while the ServerConn is used for another operation.
+func (c *ServerConn) Open(path string, options ...OpenOption) (*File, error) {
+	oo := &openOptions{readAhead: defaultReadAhead}
+	for _, option := range options {
+		option.setup(oo)
+	}
+
+	size, err := c.FileSize(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{
+		c:         c,
+		path:      path,
+		size:      size,
+		readAhead: oo.readAhead,
+	}, nil
+}
+
+// Size returns the size of the file when it was opened.
+func (f *File) Size() int64 {
+	return f.size
+}
+
+// ReadAt implements the io.ReaderAt interface.
+func (f *File) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("ftp: negative offset")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+
+	for n < len(p) {
+		if off >= f.size {
+			return n, io.EOF
+		}
+
+		if off >= f.cacheOff && off < f.cacheOff+int64(len(f.cache)) {
+			m := copy(p[n:], f.cache[off-f.cacheOff:])
+			n += m
+			off += int64(m)
+			continue
+		}
+
+		if err = f.fill(off, len(p)-n); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// fill reads at least n bytes from the offset into the cache, within the
+// size of the file
+func (f *File) fill(off int64, n int) error {
+	if n < f.readAhead {
+		n = f.readAhead
+	}
+	if rest := f.size - off; int64(n) > rest {
+		n = int(rest)
+	}
+
+	r, err := f.c.RetrFrom(f.path, uint64(off))
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, n)
+	if _, err = io.ReadFull(r, buf); err != nil {
+		_ = r.Abort()
+		return err
+	}
+
+	// The end of the file is followed by the final reply of the transfer
+	if off+int64(n) == f.size {
+		err = r.Close()
+	} else {
+		err = r.Abort()
+	}
+	if err != nil {
+		return err
+	}
+
+	f.cache, f.cacheOff = buf, off
+	return nil
+}
+
+// Read implements the io.Reader interface.
+func (f *File) Read(p []byte) (int, error) {
+	n, err := f.ReadAt(p, f.offset)
+	f.offset += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek implements the io.Seeker interface.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size
+	default:
+		return 0, errors.New("ftp: invalid whence")
+	}
+
+	if offset < 0 {
+		return 0, errors.New("ftp: negative position")
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// Close releases the cache of the File. The ServerConn stays open.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return os.ErrClosed
+	}
+	f.closed = true
+	f.cache = nil
+	return nil
+}
@@ -0,0 +1,84 @@
+package ftp
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileReadAt(t *testing.T) {
+	d, c := dialTestParallel(t, 100*1024)
+
+	f, err := c.Open("data-file", OpenWithReadAhead(1024))
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(d.data)), f.Size())
+
+	buf := make([]byte, 10)
+	n, err := f.ReadAt(buf, 50000)
+	require.NoError(t, err)
+	assert.Equal(t, 10, n)
+	assert.Equal(t, d.data[50000:50010], buf)
+
+	// served from the cache
+	n, err = f.ReadAt(buf, 50100)
+	require.NoError(t, err)
+	assert.Equal(t, d.data[50100:50110], buf[:n])
+
+	// a read larger than the read-ahead
+	big := make([]byte, 4096)
+	n, err = f.ReadAt(big, 1000)
+	require.NoError(t, err)
+	assert.Equal(t, d.data[1000:5096], big[:n])
+
+	// across the end of the file
+	buf = make([]byte, 20)
+	n, err = f.ReadAt(buf, int64(len(d.data)-10))
+	assert.Equal(t, io.EOF, err)
+	assert.Equal(t, d.data[len(d.data)-10:], buf[:n])
+
+	require.NoError(t, f.Close())
+	_, err = f.ReadAt(buf, 0)
+	assert.Equal(t, os.ErrClosed, err)
+
+	require.NoError(t, c.Quit())
+	d.mocks[0].Wait()
+	assert.Equal(t, 3, count(d.mocks[0].commands, "RETR"))
+}
+
+func TestFileReadSeek(t *testing.T) {
+	d, c := dialTestParallel(t, 100*1024)
+
+	f, err := c.Open("data-file")
+	require.NoError(t, err)
+
+	// sequential reads use the read-ahead
+	buf := make([]byte, 100)
+	for i := 0; i < 10; i++ {
+		_, err = io.ReadFull(f, buf)
+		require.NoError(t, err)
+		assert.Equal(t, d.data[i*100:(i+1)*100], buf)
+	}
+
+	pos, err := f.Seek(-10, io.SeekEnd)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(d.data)-10), pos)
+	data, err := ioutil.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, d.data[len(d.data)-10:], data)
+
+	pos, err = f.Seek(-20, io.SeekCurrent)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(d.data)-20), pos)
+
+	_, err = f.Seek(-1, io.SeekStart)
+	assert.Error(t, err)
+
+	require.NoError(t, f.Close())
+	require.NoError(t, c.Quit())
+	d.mocks[0].Wait()
+	assert.Equal(t, 2, count(d.mocks[0].commands, "RETR"))
+}
@@ -0,0 +1,233 @@
+//go:build go1.16
+// +build go1.16
+
+package ftp
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FS is a read-only fs.FS of the remote files under a root directory, see
+// ServerConn.FS. It also implements fs.ReadDirFS, fs.StatFS and
+// fs.ReadFileFS.
+//
+// The errors matching ErrNotFound and ErrPermissionDenied also match
+// fs.ErrNotExist and fs.ErrPermission.
+type FS struct {
+	c    *ServerConn
+	root string
+}
+
+// FS returns an fs.FS of the remote files under the root directory, backed
+// by List, Stat and Retr. The files implement io.ReaderAt and io.Seeker, see
+// ServerConn.Open.
+func (c *ServerConn) FS(root string) *FS {
+	return &FS{c: c, root: root}
+}
+
+// remotePath returns the path on the server of the named file. The names
+// containing a backslash are invalid, as some servers treat it as a separator.
+func (fsys *FS) remotePath(op, name string) (string, error) {
+	if !fs.ValidPath(name) || strings.ContainsRune(name, '\\') {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if fsys.root == "" {
+		return name, nil
+	}
+	return path.Join(fsys.root, name), nil
+}
+
+// Open implements fs.FS.
+func (fsys *FS) Open(name string) (fs.File, error) {
+	info, err := fsys.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return &fsDir{fsys: fsys, name: name, info: info}, nil
+	}
+
+	p, _ := fsys.remotePath("open", name)
+	f := &File{c: fsys.c, path: p, size: info.Size(), readAhead: defaultReadAhead}
+	return &fsFile{File: f, info: info}, nil
+}
+
+// Stat implements fs.StatFS.
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	return fsys.stat("stat", name)
+}
+
+func (fsys *FS) stat(op, name string) (fs.FileInfo, error) {
+	p, err := fsys.remotePath(op, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// The root is not listed by its parent
+	if name == "." {
+		return &fileInfo{Entry{Name: ".", Type: EntryTypeFolder}}, nil
+	}
+
+	entry, err := fsys.c.Stat(p)
+	if err != nil {
+		return nil, pathError(op, name, err)
+	}
+
+	info := &fileInfo{*entry}
+	info.entry.Name = path.Base(name)
+	return info, nil
+}
+
+// ReadDir implements fs.ReadDirFS. The entries are sorted by name.
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	p, err := fsys.remotePath("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := fsys.c.List(p)
+	if err != nil {
+		return nil, pathError("readdir", name, err)
+	}
+
+	dirEntries := make([]fs.DirEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Name == "." || entry.Name == ".." {
+			continue
+		}
+		dirEntries = append(dirEntries, &fileInfo{*entry})
+	}
+	sort.Slice(dirEntries, func(i, j int) bool {
+		return dirEntries[i].Name() < dirEntries[j].Name()
+	})
+	return dirEntries, nil
+}
+
+// ReadFile implements fs.ReadFileFS.
+func (fsys *FS) ReadFile(name string) ([]byte, error) {
+	p, err := fsys.remotePath("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := fsys.c.Retr(p)
+	if err != nil {
+		return nil, pathError("readfile", name, err)
+	}
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		_ = r.Abort()
+		return nil, pathError("readfile", name, err)
+	}
+	if err = r.Close(); err != nil {
+		return nil, pathError("readfile", name, err)
+	}
+	return data, nil
+}
+
+// fileInfo implements fs.FileInfo and fs.DirEntry for an Entry
+type fileInfo struct {
+	entry Entry
+}
+
+func (fi *fileInfo) Name() string {
+	return fi.entry.Name
+}
+
+func (fi *fileInfo) Size() int64 {
+	return int64(fi.entry.Size)
+}
+
+// Mode returns the type of the file. The permissions are not known, they
+// are 0755 for the directories and 0644 for the files.
+func (fi *fileInfo) Mode() fs.FileMode {
+	switch fi.entry.Type {
+	case EntryTypeFolder:
+		return fs.ModeDir | 0755
+	case EntryTypeLink:
+		return fs.ModeSymlink | 0777
+	}
+	return 0644
+}
+
+func (fi *fileInfo) ModTime() time.Time {
+	return fi.entry.Time
+}
+
+func (fi *fileInfo) IsDir() bool {
+	return fi.entry.Type == EntryTypeFolder
+}
+
+// Sys returns the *Entry
+func (fi *fileInfo) Sys() interface{} {
+	return &fi.entry
+}
+
+func (fi *fileInfo) Type() fs.FileMode {
+	return fi.Mode().Type()
+}
+
+func (fi *fileInfo) Info() (fs.FileInfo, error) {
+	return fi, nil
+}
+
+// fsFile is a regular file open by FS.Open
+type fsFile struct {
+	*File
+	info fs.FileInfo
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+// fsDir is a directory open by FS.Open
+type fsDir struct {
+	fsys    *FS
+	name    string
+	info    fs.FileInfo
+	entries []fs.DirEntry // nil until the directory is listed
+	offset  int
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *fsDir) Close() error {
+	return nil
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (d *fsDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.entries == nil {
+		entries, err := d.fsys.ReadDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+	}
+
+	rest := d.entries[d.offset:]
+	if n > 0 && len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && n < len(rest) {
+		rest = rest[:n]
+	}
+	d.offset += len(rest)
+	return rest, nil
+}
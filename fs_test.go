@@ -0,0 +1,59 @@
+//go:build go1.16
+// +build go1.16
+
+package ftp
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFS(t *testing.T) {
+	_, c := dialTestMirror(t)
+	fsys := c.FS("/mirror")
+
+	require.NoError(t, fstest.TestFS(fsys, "file", "notes.tmp", "dir", "dir/sub-file"))
+
+	data, err := fs.ReadFile(fsys, "dir/sub-file")
+	require.NoError(t, err)
+	assert.Equal(t, testData, string(data))
+
+	info, err := fs.Stat(fsys, "dir")
+	require.NoError(t, err)
+	assert.True(t, info.IsDir())
+	assert.Equal(t, fs.ModeDir|0755, info.Mode())
+	assert.Equal(t, mirrorTime, info.ModTime())
+
+	var names []string
+	err = fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		names = append(names, path)
+		return err
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{".", "dir", "dir/sub-file", "file", "notes.tmp"}, names)
+
+	require.NoError(t, c.Quit())
+}
+
+func TestFSErrors(t *testing.T) {
+	_, c := dialTestMirror(t)
+	fsys := c.FS("/mirror")
+
+	_, err := fsys.Open("missing")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	_, err = fsys.Open("../file")
+	assert.True(t, errors.Is(err, fs.ErrInvalid))
+
+	mapped := &mappedError{command{name: "RETR", path: "file"}.error(550, "Permission denied")}
+	assert.True(t, errors.Is(mapped, fs.ErrPermission))
+	assert.False(t, errors.Is(mapped, fs.ErrNotExist))
+
+	require.NoError(t, c.Quit())
+}
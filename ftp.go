@@ -1,6 +1,8 @@
 // Package ftp implements a FTP client as described in RFC 959.
 //
-// A textproto.Error is returned for errors at the protocol level.
+// An *Error is returned when the server replies with an unexpected code, it
+// can be matched with errors.Is against ErrNotFound and the other errors of
+// this package.
 package ftp
 
 import (
@@ -10,10 +12,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net"
 	"net/textproto"
+	"os"
+	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -27,19 +33,62 @@ const (
 	EntryTypeLink
 )
 
+// timeFormat is the format of the times of MDTM, MFMT and MFF, see RFC 3659
+const timeFormat = "20060102150405"
+
+// ErrConnBusy is returned when an operation is started while another one is
+// in progress on the same ServerConn, for example while a Response is open.
+var ErrConnBusy = errors.New("ftp: another command or transfer is in progress")
+
 // ServerConn represents the connection to a remote FTP server.
 // A single connection only supports one in-flight data connection.
-// It is not safe to be called concurrently.
+// It is not safe to be called concurrently, unless DialWithSerializedCalls
+// is used.
 type ServerConn struct {
 	options *dialOptions
 	conn    *textproto.Conn
+	netConn net.Conn
 	host    string
 
 	// Server capabilities discovered at runtime
 	features      map[string]string
 	skipEPSV      bool
+	skipEPRT      bool
 	mlstSupported bool
+	mdtmSupported bool
+	mfmtSupported bool
 	usePRET       bool
+	hashAlgo      string // algorithm selected for the HASH command
+
+	// Arguments of Dial and Auth, to open more sessions, see openSession
+	addr     string
+	dialArgs []DialOption
+	user     string
+	password string
+
+	// ctx is the context of the running operation, see watchContext
+	ctx context.Context
+	// stopKeepAlive stops the keepalive goroutine, if any
+	stopKeepAlive func()
+	// calls holds a token while an operation is running, see begin.
+	// It is nil unless DialWithSerializedCalls is used.
+	calls chan struct{}
+
+	ioMu sync.Mutex // serializes the control connection I/O with the keepalive
+
+	mu          sync.Mutex     // protects the fields below
+	pending     []command      // commands whose final reply was not read yet
+	broken      bool           // the control connection cannot be used anymore
+	lastUse     time.Time      // last I/O on the control connection
+	dataConn    deadlineCloser // in-flight data connection, or its listener
+	interrupted bool           // the context of the running operation is done
+}
+
+// deadlineCloser is implemented by data connections and by the listeners
+// waiting for active mode data connections
+type deadlineCloser interface {
+	io.Closer
+	SetDeadline(t time.Time) error
 }
 
 // DialOption represents an option to start a new connection with Dial
@@ -60,6 +109,20 @@ type dialOptions struct {
 	location    *time.Location
 	debugOutput io.Writer
 	dialFunc    func(network, address string) (net.Conn, error)
+
+	activeMode    bool
+	activeHost    string
+	activeMinPort int
+	activeMaxPort int
+
+	keepAlive          time.Duration
+	keepAliveErrorFunc func(error)
+
+	serializedCalls  bool
+	writingMDTM      bool
+	transferObserver func(TransferInfo)
+	downloadLimiter  *RateLimiter
+	uploadLimiter    *RateLimiter
 }
 
 // Entry describes a file and is returned by List().
@@ -76,6 +139,7 @@ type Response struct {
 	conn   net.Conn
 	c      *ServerConn
 	closed bool
+	end    func(*error) // ends the operation started by RetrFromContext
 }
 
 // Dial connects to the specified address with optional options
@@ -118,9 +182,16 @@ func Dial(addr string, options ...DialOption) (*ServerConn, error) {
 
 	c := &ServerConn{
 		options:  do,
+		addr:     addr,
+		dialArgs: options,
 		features: make(map[string]string),
 		conn:     textproto.NewConn(do.wrapConn(tconn)),
+		netConn:  tconn,
 		host:     remoteAddr.IP.String(),
+		lastUse:  time.Now(),
+	}
+	if do.serializedCalls {
+		c.calls = make(chan struct{}, 1)
 	}
 
 	_, _, err := c.conn.ReadResponse(StatusReady)
@@ -136,6 +207,11 @@ func Dial(addr string, options ...DialOption) (*ServerConn, error) {
 		}
 		tconn = tls.Client(tconn, do.tlsConfig)
 		c.conn = textproto.NewConn(do.wrapConn(tconn))
+		c.netConn = tconn
+	}
+
+	if do.keepAlive > 0 {
+		c.startKeepAlive(do.keepAlive)
 	}
 
 	return c, nil
@@ -243,6 +319,106 @@ func DialWithDialFunc(f func(network, address string) (net.Conn, error)) DialOpt
 	}}
 }
 
+// DialWithActiveMode returns a DialOption that configures the ServerConn to use
+// active mode data connections: the client listens on host and announces the
+// address to the server with EPRT, or PORT when the server does not support EPRT.
+//
+// An empty host uses the local address of the control connection.
+// Data connections are accepted on a random port unless DialWithActivePortRange
+// is also used. The DialWithDialFunc function is not used for active mode data
+// connections. Only the connections from the IP address of the server are
+// accepted.
+func DialWithActiveMode(host string) DialOption {
+	return DialOption{func(do *dialOptions) {
+		do.activeMode = true
+		do.activeHost = host
+	}}
+}
+
+// DialWithActivePortRange returns a DialOption that configures the ServerConn to
+// listen for active mode data connections on a port between minPort and maxPort
+// (inclusive). It has no effect unless DialWithActiveMode is used.
+func DialWithActivePortRange(minPort, maxPort int) DialOption {
+	return DialOption{func(do *dialOptions) {
+		do.activeMinPort = minPort
+		do.activeMaxPort = maxPort
+	}}
+}
+
+// DialWithKeepAlive returns a DialOption that configures the ServerConn to send
+// NOOP in the background when the control connection has been idle for the
+// given interval, to prevent the server or a NAT device from closing it.
+//
+// NOOP is never sent while a command or a data transfer is in progress.
+// The keepalive stops when the control connection breaks, see
+// DialWithKeepAliveErrorFunc to be notified.
+func DialWithKeepAlive(interval time.Duration) DialOption {
+	return DialOption{func(do *dialOptions) {
+		do.keepAlive = interval
+	}}
+}
+
+// DialWithKeepAliveErrorFunc returns a DialOption that configures the ServerConn
+// to call f from the keepalive goroutine when a NOOP sent by DialWithKeepAlive fails.
+func DialWithKeepAliveErrorFunc(f func(error)) DialOption {
+	return DialOption{func(do *dialOptions) {
+		do.keepAliveErrorFunc = f
+	}}
+}
+
+// DialWithWritingMDTM returns a DialOption that configures the ServerConn to
+// set the modification time of files with the non-standard "MDTM time path"
+// command when MFMT is not supported. This is what vsftpd supports with its
+// mdtm_write option.
+func DialWithWritingMDTM(enabled bool) DialOption {
+	return DialOption{func(do *dialOptions) {
+		do.writingMDTM = enabled
+	}}
+}
+
+// DialWithSerializedCalls returns a DialOption that configures the ServerConn
+// to be safe for concurrent use: each operation waits for the previous one to
+// be over. The Response returned by Retr is part of the operation until it is
+// closed or aborted, so it must be closed before the same goroutine issues
+// another command.
+func DialWithSerializedCalls(enabled bool) DialOption {
+	return DialOption{func(do *dialOptions) {
+		do.serializedCalls = enabled
+	}}
+}
+
+// DialWithTransferObserver returns a DialOption that configures the ServerConn
+// to report the progress of the transfers over data connections, including
+// the ones of List and NameList. f is called after each read or write on the
+// data connection, then once with TransferInfo.Done set when the transfer is
+// over. It is called by the goroutine doing the transfer and should return
+// quickly.
+func DialWithTransferObserver(f func(TransferInfo)) DialOption {
+	return DialOption{func(do *dialOptions) {
+		do.transferObserver = f
+	}}
+}
+
+// DialWithDownloadLimiter returns a DialOption that configures the ServerConn
+// to limit the throughput of the data it receives over data connections, such
+// as the files of Retr and the listings. The RateLimiter can be shared by
+// several ServerConn, to cap their total throughput.
+func DialWithDownloadLimiter(l *RateLimiter) DialOption {
+	return DialOption{func(do *dialOptions) {
+		do.downloadLimiter = l
+	}}
+}
+
+// DialWithUploadLimiter returns a DialOption that configures the ServerConn
+// to limit the throughput of the data it sends over data connections, such as
+// the files of Stor and Append. The RateLimiter can be shared by several
+// ServerConn, to cap their total throughput.
+func DialWithUploadLimiter(l *RateLimiter) DialOption {
+	return DialOption{func(do *dialOptions) {
+		do.uploadLimiter = l
+	}}
+}
+
 func (o *dialOptions) wrapConn(netConn net.Conn) io.ReadWriteCloser {
 	if o.debugOutput == nil {
 		return netConn
@@ -264,7 +440,13 @@ func DialTimeout(addr string, timeout time.Duration) (*ServerConn, error) {
 	return Dial(addr, DialWithTimeout(timeout))
 }
 
-func (c *ServerConn) Auth(user, password string) (code int, err error) {
+func (c *ServerConn) Auth(user, password string) (int, error) {
+	return c.AuthContext(context.Background(), user, password)
+}
+
+func (c *ServerConn) auth(user, password string) (code int, err error) {
+	c.user, c.password = user, password
+
 	code, _, err = c.cmd(-1, "USER %s", user)
 	if err != nil {
 		return 0, err
@@ -285,6 +467,10 @@ func (c *ServerConn) Auth(user, password string) (code int, err error) {
 }
 
 func (c *ServerConn) AfterAuth() error {
+	return c.AfterAuthContext(context.Background())
+}
+
+func (c *ServerConn) afterAuth() error {
 	// Probe features
 	err := c.feat()
 	if err != nil {
@@ -293,6 +479,12 @@ func (c *ServerConn) AfterAuth() error {
 	if _, mlstSupported := c.features["MLST"]; mlstSupported && !c.options.disableMLSD {
 		c.mlstSupported = true
 	}
+	if _, mdtmSupported := c.features["MDTM"]; mdtmSupported {
+		c.mdtmSupported = true
+	}
+	if _, mfmtSupported := c.features["MFMT"]; mfmtSupported {
+		c.mfmtSupported = true
+	}
 	if _, usePRET := c.features["PRET"]; usePRET {
 		c.usePRET = true
 	}
@@ -453,10 +645,16 @@ func (c *ServerConn) pasv() (host string, port int, err error) {
 // it uses the best available method to do so
 func (c *ServerConn) getDataConnPort() (string, int, error) {
 	if !c.options.disableEPSV && !c.skipEPSV {
-		if port, err := c.epsv(); err == nil {
+		port, err := c.epsv()
+		if err == nil {
 			return c.host, port, nil
 		}
 
+		// the control connection itself failed, PASV would fail too
+		if _, ok := err.(net.Error); ok {
+			return "", 0, err
+		}
+
 		// if there is an error, skip EPSV for the next attempts
 		c.skipEPSV = true
 	}
@@ -473,77 +671,398 @@ func (c *ServerConn) openDataConn() (net.Conn, error) {
 
 	addr := net.JoinHostPort(host, strconv.Itoa(port))
 	if c.options.dialFunc != nil {
-		return c.options.dialFunc("tcp", addr)
+		conn, err := c.options.dialFunc("tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		return c.limitDataConn(conn), nil
+	}
+
+	conn, err := c.options.dialer.DialContext(c.context(), "tcp", addr)
+	if err != nil {
+		return nil, err
 	}
+	conn = c.limitDataConn(conn)
 
 	if c.options.tlsConfig != nil {
-		conn, err := c.options.dialer.Dial("tcp", addr)
+		return tls.Client(conn, c.options.tlsConfig), nil
+	}
+	return conn, nil
+}
+
+// eprt issues an "EPRT" command to announce the address of an active mode
+// data connection.
+// EPRT is described in RFC 2428
+func (c *ServerConn) eprt(ip net.IP, port int) error {
+	family := 1
+	if ip.To4() == nil {
+		family = 2
+	}
+
+	_, _, err := c.cmd(StatusCommandOK, "EPRT |%d|%s|%d|", family, ip, port)
+	return err
+}
+
+// port issues a "PORT" command to announce the address of an active mode
+// data connection.
+func (c *ServerConn) port(ip net.IP, port int) error {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return errors.New("PORT requires an IPv4 address")
+	}
+
+	_, _, err := c.cmd(StatusCommandOK, "PORT %d,%d,%d,%d,%d,%d", ip4[0], ip4[1], ip4[2], ip4[3], port/256, port%256)
+	return err
+}
+
+// listenActive listens on ip, within the configured port range if any.
+func (c *ServerConn) listenActive(ip net.IP) (net.Listener, error) {
+	minPort, maxPort := c.options.activeMinPort, c.options.activeMaxPort
+	if minPort <= 0 || maxPort < minPort {
+		return net.Listen("tcp", net.JoinHostPort(ip.String(), "0"))
+	}
+
+	// Start at a random port of the range so that consecutive transfers
+	// do not compete for the same port while it is in TIME_WAIT
+	count := maxPort - minPort + 1
+	start := rand.Intn(count)
+
+	var err error
+	for i := 0; i < count; i++ {
+		port := minPort + (start+i)%count
+
+		var l net.Listener
+		l, err = net.Listen("tcp", net.JoinHostPort(ip.String(), strconv.Itoa(port)))
+		if err == nil {
+			return l, nil
+		}
+	}
+
+	return nil, fmt.Errorf("no free port in range %d-%d: %w", minPort, maxPort, err)
+}
+
+// listenDataConn listens for an active mode data connection and announces
+// its address to the server. It uses the best available method to do so.
+func (c *ServerConn) listenDataConn() (net.Listener, error) {
+	var ip net.IP
+	if c.options.activeHost != "" {
+		ip = net.ParseIP(c.options.activeHost)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid active mode address: %s", c.options.activeHost)
+		}
+	} else {
+		ip = c.netConn.LocalAddr().(*net.TCPAddr).IP
+	}
+
+	l, err := c.listenActive(ip)
+	if err != nil {
+		return nil, err
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+
+	if !c.skipEPRT {
+		if err = c.eprt(ip, port); err == nil {
+			return l, nil
+		}
+
+		// PORT only knows about IPv4, so there is nothing to fall back to,
+		// and PORT would fail too if the control connection itself failed
+		if _, ok := err.(net.Error); ok || ip.To4() == nil {
+			_ = l.Close()
+			return nil, err
+		}
+
+		// if there is an error, skip EPRT for the next attempts
+		c.skipEPRT = true
+	}
+
+	if err = c.port(ip, port); err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// acceptDataConn waits for the server to connect to an active mode listener.
+// The listener is closed once the connection is accepted.
+//
+// The connections which do not come from the address of the server are
+// closed, as anyone could connect to the listener to inject or steal data.
+func (c *ServerConn) acceptDataConn(l net.Listener) (net.Conn, error) {
+	defer l.Close()
+
+	// The server may never connect, for example after replying 425
+	if tl, ok := l.(*net.TCPListener); ok {
+		if err := tl.SetDeadline(time.Now().Add(c.resyncTimeout())); err != nil {
+			return nil, err
+		}
+		c.setDataConn(tl)
+	}
+
+	server, _ := c.netConn.RemoteAddr().(*net.TCPAddr)
+	var conn net.Conn
+	for {
+		var err error
+		conn, err = l.Accept()
 		if err != nil {
 			return nil, err
 		}
-		return tls.Client(conn, c.options.tlsConfig), err
+
+		peer, ok := conn.RemoteAddr().(*net.TCPAddr)
+		if server == nil || ok && peer.IP.Equal(server.IP) {
+			break
+		}
+		_ = conn.Close()
+	}
+	conn = c.limitDataConn(conn)
+
+	// The client is always the TLS client, even if the server initiated
+	// the TCP connection
+	if c.options.tlsConfig != nil {
+		return tls.Client(conn, c.options.tlsConfig), nil
+	}
+
+	return conn, nil
+}
+
+// abortAccept reads the final reply of the command whose active mode data
+// connection was not accepted, with ABOR in case the server still waits to
+// connect. The control connection is broken if the replies are not received.
+// After an interruption, the replies are read by the context recovery.
+func (c *ServerConn) abortAccept(l net.Listener) {
+	if c.isInterrupted() {
+		return
 	}
 
-	return c.options.dialer.Dial("tcp", addr)
+	if err := c.netConn.SetReadDeadline(time.Now().Add(c.resyncTimeout())); err == nil {
+		_ = c.abort(l)
+	}
+	if err := c.netConn.SetReadDeadline(time.Time{}); err != nil || c.pendingReplies() > 0 {
+		c.setBroken()
+	}
 }
 
 // cmd is a helper function to execute a command and check for the expected FTP
 // return code
 func (c *ServerConn) cmd(expected int, format string, args ...interface{}) (int, string, error) {
-	_, err := c.conn.Cmd(format, args...)
+	err := c.sendCmd(format, args...)
 	if err != nil {
 		return 0, "", err
 	}
 
-	return c.conn.ReadResponse(expected)
+	return c.readResponse(expected)
+}
+
+// sendCmd sends a command without waiting for its reply.
+func (c *ServerConn) sendCmd(format string, args ...interface{}) error {
+	line := fmt.Sprintf(format, args...)
+
+	// The command is pending before ioMu is released, so that the keepalive
+	// does not send NOOP and read its reply in the meantime
+	c.ioMu.Lock()
+	defer c.ioMu.Unlock()
+	_, err := c.conn.Cmd("%s", line)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lastUse = time.Now()
+	if err != nil {
+		c.broken = true
+		return err
+	}
+
+	c.pending = append(c.pending, parseCommand(line))
+	return nil
+}
+
+// readResponse reads the final reply of the oldest pending command and
+// checks for the expected FTP return code.
+func (c *ServerConn) readResponse(expected int) (int, string, error) {
+	c.ioMu.Lock()
+	code, msg, err := c.conn.ReadResponse(expected)
+	c.ioMu.Unlock()
+
+	_, ok := err.(*textproto.Error)
+	cmd := c.replied(ok || err == nil, code, err)
+	if ok {
+		err = cmd.error(code, msg)
+	}
+
+	return code, msg, err
+}
+
+// readDataResponse reads the preliminary reply of a command which requires
+// a data connection. Its final reply is read once the transfer is over,
+// unless the command is refused.
+func (c *ServerConn) readDataResponse() (int, string, error) {
+	c.ioMu.Lock()
+	code, msg, err := c.conn.ReadResponse(-1)
+	c.ioMu.Unlock()
+
+	refused := err == nil && code != StatusAlreadyOpen && code != StatusAboutToSend
+	cmd := c.replied(refused, code, err)
+	if refused {
+		err = cmd.error(code, msg)
+	}
+
+	return code, msg, err
+}
+
+// replied updates the state of the control connection after a reply was read,
+// and returns the command it answers if it is final.
+// The connection cannot be used anymore after a network error or when the
+// server is closing it.
+func (c *ServerConn) replied(final bool, code int, err error) (cmd command) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.lastUse = time.Now()
+	if final && len(c.pending) > 0 {
+		cmd = c.pending[0]
+		c.pending = c.pending[1:]
+	}
+	if _, ok := err.(*textproto.Error); (err != nil && !ok) || code == StatusNotAvailable {
+		c.broken = true
+	}
+
+	return cmd
+}
+
+// pendingReplies returns the number of commands whose final reply was not read yet.
+func (c *ServerConn) pendingReplies() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.pending)
+}
+
+// isBroken reports whether the control connection cannot be used anymore.
+func (c *ServerConn) isBroken() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.broken
+}
+
+// setBroken records that the control connection cannot be used anymore.
+func (c *ServerConn) setBroken() {
+	c.mu.Lock()
+	c.broken = true
+	c.mu.Unlock()
+}
+
+// setDataConn records the in-flight data connection, nil when the transfer is over.
+func (c *ServerConn) setDataConn(conn deadlineCloser) {
+	c.mu.Lock()
+	c.dataConn = conn
+	if c.interrupted && conn != nil {
+		_ = conn.SetDeadline(aLongTimeAgo)
+	}
+	c.mu.Unlock()
+}
+
+// isInterrupted reports whether the context of the running operation is done.
+func (c *ServerConn) isInterrupted() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.interrupted
+}
+
+// context returns the context of the running operation.
+func (c *ServerConn) context() context.Context {
+	if c.ctx == nil {
+		return context.Background()
+	}
+	return c.ctx
 }
 
 // cmdDataConnFrom executes a command which require a FTP data connection.
 // Issues a REST FTP command to specify the number of bytes to skip for the transfer.
 func (c *ServerConn) cmdDataConnFrom(offset uint64, format string, args ...interface{}) (net.Conn, error) {
+	conn, _, err := c.cmdDataConnReply(offset, format, args...)
+	return conn, err
+}
+
+// cmdDataConnReply is like cmdDataConnFrom but it also returns the message of
+// the preliminary reply.
+func (c *ServerConn) cmdDataConnReply(offset uint64, format string, args ...interface{}) (net.Conn, string, error) {
 	// If server requires PRET send the PRET command to warm it up
 	// See: https://tools.ietf.org/html/draft-dd-pret-00
 	if c.usePRET {
 		_, _, err := c.cmd(-1, "PRET "+format, args...)
 		if err != nil {
-			return nil, err
+			return nil, "", err
 		}
 	}
 
-	conn, err := c.openDataConn()
+	// In active mode, the server connects to us once the command is sent,
+	// otherwise we connect to the server right away.
+	var conn net.Conn
+	var l net.Listener
+	var err error
+	if c.options.activeMode {
+		l, err = c.listenDataConn()
+	} else {
+		conn, err = c.openDataConn()
+	}
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+
+	closeDataConn := func() {
+		if conn != nil {
+			_ = conn.Close()
+		}
+		if l != nil {
+			_ = l.Close()
+		}
 	}
 
 	if offset != 0 {
 		_, _, err = c.cmd(StatusRequestFilePending, "REST %d", offset)
 		if err != nil {
-			_ = conn.Close()
-			return nil, err
+			closeDataConn()
+			return nil, "", err
 		}
 	}
 
-	_, err = c.conn.Cmd(format, args...)
+	err = c.sendCmd(format, args...)
 	if err != nil {
-		_ = conn.Close()
-		return nil, err
+		closeDataConn()
+		return nil, "", err
 	}
 
-	code, msg, err := c.conn.ReadResponse(-1)
+	// The preliminary reply is read here, the final reply is read once
+	// the transfer is over
+	_, msg, err := c.readDataResponse()
 	if err != nil {
-		_ = conn.Close()
-		return nil, err
+		closeDataConn()
+		return nil, "", err
 	}
-	if code != StatusAlreadyOpen && code != StatusAboutToSend {
-		_ = conn.Close()
-		return nil, &textproto.Error{Code: code, Msg: msg}
+
+	if l != nil {
+		conn, err = c.acceptDataConn(l)
+		if err != nil {
+			c.setDataConn(nil)
+			c.abortAccept(l)
+			return nil, "", err
+		}
 	}
 
-	return conn, nil
+	if c.options.transferObserver != nil {
+		conn = newObservedConn(conn, c.options.transferObserver, fmt.Sprintf(format, args...), offset, msg)
+	}
+
+	c.setDataConn(conn)
+	return conn, msg, nil
 }
 
 // NameList issues an NLST FTP command.
-func (c *ServerConn) NameList(path string) (entries []string, err error) {
+func (c *ServerConn) NameList(path string) ([]string, error) {
+	return c.NameListContext(context.Background(), path)
+}
+
+func (c *ServerConn) nameList(path string) (entries []string, err error) {
 	space := " "
 	if path == "" {
 		space = ""
@@ -571,7 +1090,11 @@ func (c *ServerConn) NameList(path string) (entries []string, err error) {
 }
 
 // List issues a LIST FTP command.
-func (c *ServerConn) List(path string) (entries []*Entry, err error) {
+func (c *ServerConn) List(path string) ([]*Entry, error) {
+	return c.ListContext(context.Background(), path)
+}
+
+func (c *ServerConn) list(path string) (entries []*Entry, err error) {
 	var cmd string
 	var parser parseFunc
 
@@ -616,6 +1139,10 @@ func (c *ServerConn) List(path string) (entries []*Entry, err error) {
 // ChangeDir issues a CWD FTP command, which changes the current directory to
 // the specified path.
 func (c *ServerConn) ChangeDir(path string) error {
+	return c.ChangeDirContext(context.Background(), path)
+}
+
+func (c *ServerConn) changeDir(path string) error {
 	_, _, err := c.cmd(StatusRequestedFileActionOK, "CWD %s", path)
 	return err
 }
@@ -624,6 +1151,10 @@ func (c *ServerConn) ChangeDir(path string) error {
 // directory to the parent directory.  This is similar to a call to ChangeDir
 // with a path set to "..".
 func (c *ServerConn) ChangeDirToParent() error {
+	return c.ChangeDirToParentContext(context.Background())
+}
+
+func (c *ServerConn) changeDirToParent() error {
 	_, _, err := c.cmd(StatusRequestedFileActionOK, "CDUP")
 	return err
 }
@@ -631,6 +1162,10 @@ func (c *ServerConn) ChangeDirToParent() error {
 // CurrentDir issues a PWD FTP command, which Returns the path of the current
 // directory.
 func (c *ServerConn) CurrentDir() (string, error) {
+	return c.CurrentDirContext(context.Background())
+}
+
+func (c *ServerConn) currentDir() (string, error) {
 	_, msg, err := c.cmd(StatusPathCreated, "PWD")
 	if err != nil {
 		return "", err
@@ -648,6 +1183,10 @@ func (c *ServerConn) CurrentDir() (string, error) {
 
 // FileSize issues a SIZE FTP command, which Returns the size of the file
 func (c *ServerConn) FileSize(path string) (int64, error) {
+	return c.FileSizeContext(context.Background(), path)
+}
+
+func (c *ServerConn) fileSize(path string) (int64, error) {
 	_, msg, err := c.cmd(StatusFile, "SIZE %s", path)
 	if err != nil {
 		return 0, err
@@ -656,6 +1195,181 @@ func (c *ServerConn) FileSize(path string) (int64, error) {
 	return strconv.ParseInt(msg, 10, 64)
 }
 
+// GetTime issues a MDTM FTP command, which returns the modification time of
+// the file in UTC.
+func (c *ServerConn) GetTime(path string) (time.Time, error) {
+	return c.GetTimeContext(context.Background(), path)
+}
+
+func (c *ServerConn) getTime(path string) (time.Time, error) {
+	_, msg, err := c.cmd(StatusFile, "MDTM %s", path)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// The fractional seconds, if any, are parsed too
+	return time.ParseInLocation(timeFormat, msg, time.UTC)
+}
+
+// SetTime sets the modification time of the file with the MFMT FTP command.
+// If the server does not support MFMT, the "MDTM time path" command is used
+// instead when enabled by DialWithWritingMDTM.
+//
+// An error matching ErrNotSupported is returned if the server supports neither.
+func (c *ServerConn) SetTime(path string, t time.Time) error {
+	return c.SetTimeContext(context.Background(), path, t)
+}
+
+func (c *ServerConn) setTime(path string, t time.Time) error {
+	utime := t.UTC().Format(timeFormat)
+
+	var err error
+	switch {
+	case c.mfmtSupported:
+		_, _, err = c.cmd(StatusFile, "MFMT %s %s", utime, path)
+	case c.mdtmSupported && c.options.writingMDTM:
+		_, _, err = c.cmd(StatusFile, "MDTM %s %s", utime, path)
+	default:
+		err = fmt.Errorf("%w: MFMT", ErrNotSupported)
+	}
+
+	return err
+}
+
+// Facts are the facts of a file which can be changed with SetFacts.
+// The facts with a zero value are left unchanged.
+type Facts struct {
+	ModTime    time.Time   // the "modify" fact
+	CreateTime time.Time   // the "create" fact
+	Mode       os.FileMode // the permission bits, the "unix.mode" fact
+}
+
+// SetFacts issues a MFF FTP command, which changes the facts of the file.
+//
+// An error matching ErrNotSupported is returned if the server does not
+// support MFF or one of the facts to change.
+func (c *ServerConn) SetFacts(path string, facts Facts) error {
+	return c.SetFactsContext(context.Background(), path, facts)
+}
+
+func (c *ServerConn) setFacts(path string, facts Facts) error {
+	desc, ok := c.features["MFF"]
+	if !ok {
+		return fmt.Errorf("%w: MFF", ErrNotSupported)
+	}
+
+	// The supported facts are advertised as "MFF modify;create;unix.mode;"
+	supported := make(map[string]bool)
+	for _, fact := range strings.Split(desc, ";") {
+		supported[strings.ToLower(fact)] = true
+	}
+
+	var b strings.Builder
+	addFact := func(name, value string) error {
+		if !supported[name] {
+			return fmt.Errorf("%w: MFF %s", ErrNotSupported, name)
+		}
+		fmt.Fprintf(&b, "%s=%s;", name, value)
+		return nil
+	}
+
+	if !facts.ModTime.IsZero() {
+		if err := addFact("modify", facts.ModTime.UTC().Format(timeFormat)); err != nil {
+			return err
+		}
+	}
+	if !facts.CreateTime.IsZero() {
+		if err := addFact("create", facts.CreateTime.UTC().Format(timeFormat)); err != nil {
+			return err
+		}
+	}
+	if facts.Mode != 0 {
+		if err := addFact("unix.mode", fmt.Sprintf("%04o", facts.Mode.Perm())); err != nil {
+			return err
+		}
+	}
+	if b.Len() == 0 {
+		return nil
+	}
+
+	_, _, err := c.cmd(StatusFile, "MFF %s %s", b.String(), path)
+	return err
+}
+
+// Stat returns the Entry describing the file or directory at path. It issues
+// a MLST FTP command if the server supports it, otherwise it lists the parent
+// directory and looks for the entry.
+//
+// The returned error matches ErrNotFound if the path does not exist.
+func (c *ServerConn) Stat(path string) (*Entry, error) {
+	return c.StatContext(context.Background(), path)
+}
+
+func (c *ServerConn) stat(path string) (*Entry, error) {
+	if c.mlstSupported {
+		return c.mlst(path)
+	}
+
+	dir, name := splitPath(path)
+	if name == "" || name == "." || name == ".." {
+		// The root and relative directories are not listed by their parent
+		if name == "" {
+			name = path
+		}
+		return &Entry{Name: name, Type: EntryTypeFolder}, nil
+	}
+
+	entries, err := c.list(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.Name == name {
+			return entry, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrNotFound, path)
+}
+
+// mlst issues a MLST FTP command and parses the facts of the reply
+func (c *ServerConn) mlst(path string) (*Entry, error) {
+	_, msg, err := c.cmd(StatusRequestedFileActionOK, "MLST %s", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// The facts are on the line starting with a space
+	for _, line := range strings.Split(msg, "\n") {
+		if !strings.HasPrefix(line, " ") {
+			continue
+		}
+
+		entry, err := parseRFC3659ListLine(line[1:], time.Now(), c.options.location)
+		if err != nil {
+			return nil, err
+		}
+		_, entry.Name = splitPath(entry.Name)
+		return entry, nil
+	}
+
+	return nil, errors.New("unsupported MLST response format")
+}
+
+// splitPath splits a path into its parent directory, empty for the current
+// directory, and its last element.
+func splitPath(path string) (dir, name string) {
+	name = strings.TrimRight(path, "/")
+	if name == "" {
+		return path, ""
+	}
+
+	if i := strings.LastIndexByte(name, '/'); i >= 0 {
+		return name[:i+1], name[i+1:]
+	}
+	return "", name
+}
+
 // Retr issues a RETR FTP command to fetch the specified file from the remote
 // FTP server.
 //
@@ -669,6 +1383,10 @@ func (c *ServerConn) Retr(path string) (*Response, error) {
 //
 // The returned ReadCloser must be closed to cleanup the FTP data connection.
 func (c *ServerConn) RetrFrom(path string, offset uint64) (*Response, error) {
+	return c.RetrFromContext(context.Background(), path, offset)
+}
+
+func (c *ServerConn) retrFrom(path string, offset uint64) (*Response, error) {
 	conn, err := c.cmdDataConnFrom(offset, "RETR %s", path)
 	if err != nil {
 		return nil, err
@@ -680,7 +1398,7 @@ func (c *ServerConn) RetrFrom(path string, offset uint64) (*Response, error) {
 // Stor issues a STOR FTP command to store a file to the remote FTP server.
 // Stor creates the specified file with the content of the io.Reader.
 //
-// Hint: io.Pipe() can be used if an io.Writer is required.
+// Hint: StorWriter can be used if an io.Writer is required.
 func (c *ServerConn) Stor(path string, r io.Reader) error {
 	return c.StorFrom(path, r, 0)
 }
@@ -689,13 +1407,32 @@ func (c *ServerConn) Stor(path string, r io.Reader) error {
 // Stor creates the specified file with the content of the io.Reader, writing
 // on the server will start at the given file offset.
 //
-// Hint: io.Pipe() can be used if an io.Writer is required.
+// If the io.Reader returns an error, the transfer is aborted with ABOR
+// and that error is returned.
+//
+// Hint: StorWriter can be used if an io.Writer is required.
 func (c *ServerConn) StorFrom(path string, r io.Reader, offset uint64) error {
+	return c.StorFromContext(context.Background(), path, r, offset)
+}
+
+func (c *ServerConn) storFrom(path string, r io.Reader, offset uint64) error {
 	conn, err := c.cmdDataConnFrom(offset, "STOR %s", path)
 	if err != nil {
 		return err
 	}
 
+	_, err = c.upload(conn, r)
+	return err
+}
+
+// upload sends the content of the io.Reader over the data connection of a
+// STOR or STOU command, and returns the message of the final reply.
+func (c *ServerConn) upload(conn net.Conn, r io.Reader) (msg string, err error) {
+	defer func() { endTransfer(conn, err) }()
+	setTransferSize(conn, r)
+
+	src := &sourceReader{Reader: r}
+
 	// if the upload fails we still need to try to read the server
 	// response otherwise if the failure is not due to a connection problem,
 	// for example the server denied the upload for quota limits, we miss
@@ -703,8 +1440,18 @@ func (c *ServerConn) StorFrom(path string, r io.Reader, offset uint64) error {
 	// So we don't check io.Copy error and we return the error from
 	// ReadResponse so the user can see the real error
 	var n int64
-	n, err = io.Copy(conn, r)
+	n, err = io.Copy(conn, src)
+	if src.err != nil || c.isInterrupted() {
+		return "", c.abortUpload(conn, src.err, err)
+	}
+
+	return c.finishUpload(conn, n, err)
+}
 
+// finishUpload closes the data connection of an upload which sent n bytes
+// and returns the message of the final reply. The error of the reply is
+// returned in preference to err.
+func (c *ServerConn) finishUpload(conn net.Conn, n int64, err error) (string, error) {
 	// If we wrote no bytes but got no error, make sure we call
 	// tls.Handshake on the connection as it won't get called
 	// unless Write() is called.
@@ -720,35 +1467,118 @@ func (c *ServerConn) StorFrom(path string, r io.Reader, offset uint64) error {
 
 	// Use io.Copy or Handshake error in preference to this one
 	closeErr := conn.Close()
+	c.setDataConn(nil)
 	if err == nil {
 		err = closeErr
 	}
 
 	// Read the response and use this error in preference to
 	// previous errors
-	_, _, respErr := c.conn.ReadResponse(StatusClosingDataConnection)
+	_, msg, respErr := c.readResponse(StatusClosingDataConnection)
 	if respErr != nil {
 		err = respErr
 	}
-	return err
+	return msg, err
+}
+
+// StorUnique issues a STOU FTP command to store a file under a name chosen
+// by the server, in the current directory, and returns that name.
+//
+// The name is read from the replies of the server. If it cannot be found,
+// the file is stored anyway but an error is returned.
+func (c *ServerConn) StorUnique(r io.Reader) (string, error) {
+	return c.StorUniqueContext(context.Background(), r)
+}
+
+func (c *ServerConn) storUnique(r io.Reader) (string, error) {
+	conn, msg, err := c.cmdDataConnReply(0, "STOU")
+	if err != nil {
+		return "", err
+	}
+
+	final, err := c.upload(conn, r)
+	if err != nil {
+		return "", err
+	}
+
+	for _, msg := range []string{msg, final} {
+		if name := parseUniqueName(msg); name != "" {
+			return name, nil
+		}
+	}
+	return "", errors.New("ftp: the server did not send the name of the stored file")
+}
+
+// parseUniqueName returns the name of the file stored by STOU, as found in
+// the message of a reply, or "" if there is none. The formats are:
+//
+//	150 FILE: name                                 (RFC 1123, vsftpd, ProFTPD)
+//	226 Transfer complete (unique file name:name). (wu-ftpd, Pure-FTPd)
+//	150 Opening BINARY mode data connection for name. (IIS)
+func parseUniqueName(msg string) string {
+	// The name is on the last line of multi-line replies
+	if i := strings.LastIndexByte(msg, '\n'); i >= 0 {
+		msg = msg[i+1:]
+	}
+	lower := strings.ToLower(msg)
+
+	if i := strings.Index(lower, "file:"); i >= 0 && (i == 0 || lower[i-1] == ' ') {
+		return strings.TrimSpace(msg[i+len("file:"):])
+	}
+
+	for _, prefix := range []string{"unique file name:", "unique name:"} {
+		if i := strings.Index(lower, prefix); i >= 0 {
+			name := strings.TrimSpace(msg[i+len(prefix):])
+			if j := strings.LastIndexByte(name, ')'); j >= 0 {
+				name = name[:j]
+			}
+			return strings.TrimSpace(name)
+		}
+	}
+
+	if i := strings.Index(lower, "data connection for "); i >= 0 {
+		name := msg[i+len("data connection for "):]
+		if j := strings.LastIndex(name, " ("); j >= 0 {
+			name = name[:j]
+		}
+		name = strings.TrimSuffix(name, ".")
+		return strings.Trim(name, "'\"")
+	}
+
+	return ""
 }
 
 // Append issues a APPE FTP command to store a file to the remote FTP server.
 // If a file already exists with the given path, then the content of the
 // io.Reader is appended. Otherwise, a new file is created with that content.
 //
-// Hint: io.Pipe() can be used if an io.Writer is required.
+// If the io.Reader returns an error, the transfer is aborted with ABOR
+// and that error is returned.
+//
+// Hint: AppendWriter can be used if an io.Writer is required.
 func (c *ServerConn) Append(path string, r io.Reader) error {
+	return c.AppendContext(context.Background(), path, r)
+}
+
+func (c *ServerConn) appendFile(path string, r io.Reader) (err error) {
 	conn, err := c.cmdDataConnFrom(0, "APPE %s", path)
 	if err != nil {
 		return err
 	}
+	defer func() { endTransfer(conn, err) }()
+	setTransferSize(conn, r)
 
 	// see the comment for StorFrom above
-	_, err = io.Copy(conn, r)
+	src := &sourceReader{Reader: r}
+	_, err = io.Copy(conn, src)
+	if src.err != nil || c.isInterrupted() {
+		return c.abortUpload(conn, src.err, err)
+	}
+
 	errClose := conn.Close()
+	c.setDataConn(nil)
 
-	_, _, respErr := c.conn.ReadResponse(StatusClosingDataConnection)
+	_, _, respErr := c.readResponse(StatusClosingDataConnection)
 	if respErr != nil {
 		err = respErr
 	}
@@ -762,6 +1592,10 @@ func (c *ServerConn) Append(path string, r io.Reader) error {
 
 // Rename renames a file on the remote FTP server.
 func (c *ServerConn) Rename(from, to string) error {
+	return c.RenameContext(context.Background(), from, to)
+}
+
+func (c *ServerConn) rename(from, to string) error {
 	_, _, err := c.cmd(StatusRequestFilePending, "RNFR %s", from)
 	if err != nil {
 		return err
@@ -774,6 +1608,10 @@ func (c *ServerConn) Rename(from, to string) error {
 // Delete issues a DELE FTP command to delete the specified file from the
 // remote FTP server.
 func (c *ServerConn) Delete(path string) error {
+	return c.DeleteContext(context.Background(), path)
+}
+
+func (c *ServerConn) deleteFile(path string) error {
 	_, _, err := c.cmd(StatusRequestedFileActionOK, "DELE %s", path)
 	return err
 }
@@ -781,16 +1619,20 @@ func (c *ServerConn) Delete(path string) error {
 // RemoveDirRecur deletes a non-empty folder recursively using
 // RemoveDir and Delete
 func (c *ServerConn) RemoveDirRecur(path string) error {
-	err := c.ChangeDir(path)
+	return c.RemoveDirRecurContext(context.Background(), path)
+}
+
+func (c *ServerConn) removeDirRecur(path string) error {
+	err := c.changeDir(path)
 	if err != nil {
 		return err
 	}
-	currentDir, err := c.CurrentDir()
+	currentDir, err := c.currentDir()
 	if err != nil {
 		return err
 	}
 
-	entries, err := c.List(currentDir)
+	entries, err := c.list(currentDir)
 	if err != nil {
 		return err
 	}
@@ -798,29 +1640,55 @@ func (c *ServerConn) RemoveDirRecur(path string) error {
 	for _, entry := range entries {
 		if entry.Name != ".." && entry.Name != "." {
 			if entry.Type == EntryTypeFolder {
-				err = c.RemoveDirRecur(currentDir + "/" + entry.Name)
+				err = c.removeDirRecur(currentDir + "/" + entry.Name)
 				if err != nil {
 					return err
 				}
 			} else {
-				err = c.Delete(entry.Name)
+				err = c.deleteFile(entry.Name)
 				if err != nil {
 					return err
 				}
 			}
 		}
 	}
-	err = c.ChangeDirToParent()
+	err = c.changeDirToParent()
 	if err != nil {
 		return err
 	}
-	err = c.RemoveDir(currentDir)
+	err = c.removeDir(currentDir)
 	return err
 }
 
+// removeAll removes the file, and the content of the directories, by path.
+// Unlike RemoveDirRecur, it does not change the current directory.
+func (c *ServerConn) removeAll(p string, entry *Entry) error {
+	if entry.Type != EntryTypeFolder {
+		return c.Delete(p)
+	}
+
+	entries, err := c.List(p)
+	if err != nil {
+		return err
+	}
+	for _, child := range entries {
+		if child.Name == "." || child.Name == ".." {
+			continue
+		}
+		if err = c.removeAll(path.Join(p, child.Name), child); err != nil {
+			return err
+		}
+	}
+	return c.RemoveDir(p)
+}
+
 // MakeDir issues a MKD FTP command to create the specified directory on the
 // remote FTP server.
 func (c *ServerConn) MakeDir(path string) error {
+	return c.MakeDirContext(context.Background(), path)
+}
+
+func (c *ServerConn) makeDir(path string) error {
 	_, _, err := c.cmd(StatusPathCreated, "MKD %s", path)
 	return err
 }
@@ -828,11 +1696,16 @@ func (c *ServerConn) MakeDir(path string) error {
 // RemoveDir issues a RMD FTP command to remove the specified directory from
 // the remote FTP server.
 func (c *ServerConn) RemoveDir(path string) error {
+	return c.RemoveDirContext(context.Background(), path)
+}
+
+func (c *ServerConn) removeDir(path string) error {
 	_, _, err := c.cmd(StatusRequestedFileActionOK, "RMD %s", path)
 	return err
 }
 
 //Walk prepares the internal walk function so that the caller can begin traversing the directory
+//The walk ends at the first directory that cannot be listed, see WalkDir to go on past it
 func (c *ServerConn) Walk(root string) *Walker {
 	w := new(Walker)
 	w.serverConn = c
@@ -851,12 +1724,20 @@ func (c *ServerConn) Walk(root string) *Walker {
 // NOOP has no effects and is usually used to prevent the remote FTP server to
 // close the otherwise idle connection.
 func (c *ServerConn) NoOp() error {
+	return c.NoOpContext(context.Background())
+}
+
+func (c *ServerConn) noOp() error {
 	_, _, err := c.cmd(StatusCommandOK, "NOOP")
 	return err
 }
 
 // Logout issues a REIN FTP command to logout the current user.
 func (c *ServerConn) Logout() error {
+	return c.LogoutContext(context.Background())
+}
+
+func (c *ServerConn) logout() error {
 	_, _, err := c.cmd(StatusReady, "REIN")
 	return err
 }
@@ -864,6 +1745,10 @@ func (c *ServerConn) Logout() error {
 // Quit issues a QUIT FTP command to properly close the connection from the
 // remote FTP server.
 func (c *ServerConn) Quit() error {
+	if c.stopKeepAlive != nil {
+		c.stopKeepAlive()
+	}
+	c.setBroken()
 	_, errQuit := c.conn.Cmd("QUIT")
 	err := c.conn.Close()
 
@@ -888,12 +1773,50 @@ func (r *Response) Close() error {
 	if r.closed {
 		return nil
 	}
+
+	// Let the context recovery abort the transfer
+	if r.end != nil && r.c.isInterrupted() {
+		r.closed = true
+		err := r.c.context().Err()
+		endTransfer(r.conn, err)
+		r.end(&err)
+		return err
+	}
+
 	err := r.conn.Close()
-	_, _, err2 := r.c.conn.ReadResponse(StatusClosingDataConnection)
+	r.c.setDataConn(nil)
+	_, _, err2 := r.c.readResponse(StatusClosingDataConnection)
 	if err2 != nil {
 		err = err2
 	}
 	r.closed = true
+	endTransfer(r.conn, err)
+	if r.end != nil {
+		r.end(&err)
+	}
+	return err
+}
+
+// Abort stops the transfer before its end: ABOR is sent to the server and
+// the data connection is closed, so that the ServerConn can issue other
+// commands without reading the rest of the file.
+// After the first call, Abort and Close will do nothing and return nil.
+func (r *Response) Abort() error {
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+
+	r.c.setDataConn(nil)
+	err := r.c.abort(r.conn)
+	if err != nil {
+		endTransfer(r.conn, err)
+	} else {
+		endTransfer(r.conn, ErrTransferAborted)
+	}
+	if r.end != nil {
+		r.end(&err)
+	}
 	return err
 }
 
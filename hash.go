@@ -0,0 +1,145 @@
+package ftp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// HashAlgo is a hash algorithm computed by the server, see Hash.
+type HashAlgo int
+
+// The hash algorithms supported by Hash
+const (
+	HashCRC32 HashAlgo = iota
+	HashMD5
+	HashSHA1
+	HashSHA256
+	HashSHA512
+)
+
+// hashAlgos are the names of the algorithms for the HASH command and the
+// vendor commands computing them
+var hashAlgos = [...]struct {
+	name    string
+	command string
+}{
+	HashCRC32:  {"CRC32", "XCRC"},
+	HashMD5:    {"MD5", "XMD5"},
+	HashSHA1:   {"SHA-1", "XSHA1"},
+	HashSHA256: {"SHA-256", "XSHA256"},
+	HashSHA512: {"SHA-512", "XSHA512"},
+}
+
+// String returns the name of the hash algorithm, as used by the HASH command.
+func (a HashAlgo) String() string {
+	return hashAlgos[a].name
+}
+
+// Hash returns the hash of the file computed by the server, as a lowercase
+// hexadecimal string.
+//
+// The HASH command (draft-bryan-ftpext-hash) is used if the server advertises
+// the algorithm, otherwise the vendor command computing it, such as XMD5.
+// An error matching ErrNotSupported is returned if the server supports none.
+func (c *ServerConn) Hash(path string, algo HashAlgo) (string, error) {
+	return c.HashContext(context.Background(), path, algo)
+}
+
+// HashRange is like Hash but only the bytes from start to end, excluded,
+// are hashed. It requires the server to support the HASH and RANG commands.
+func (c *ServerConn) HashRange(path string, algo HashAlgo, start, end int64) (string, error) {
+	return c.HashRangeContext(context.Background(), path, algo, start, end)
+}
+
+// hash computes the hash of the bytes from start to end, or of the whole
+// file if end is negative
+func (c *ServerConn) hash(path string, algo HashAlgo, start, end int64) (string, error) {
+	ranged := end >= 0
+	if ranged && (start < 0 || end <= start) {
+		return "", fmt.Errorf("invalid hash range %d-%d", start, end)
+	}
+
+	if c.hashSupported(algo) && (!ranged || c.rangSupported()) {
+		return c.hashCmd(path, algo, start, end)
+	}
+
+	command := hashAlgos[algo].command
+	if _, ok := c.features[command]; ok && !ranged {
+		_, msg, err := c.cmd(2, "%s %s", command, path)
+		if err != nil {
+			return "", err
+		}
+
+		// Some servers follow the hash with the path
+		fields := strings.Fields(msg)
+		if len(fields) == 0 {
+			return "", fmt.Errorf("unsupported %s response format", command)
+		}
+		return strings.ToLower(fields[0]), nil
+	}
+
+	if ranged {
+		return "", fmt.Errorf("%w: RANG with HASH %s", ErrNotSupported, algo)
+	}
+	return "", fmt.Errorf("%w: HASH %s or %s", ErrNotSupported, algo, command)
+}
+
+// hashCmd selects the algorithm and the range, and issues a HASH command
+func (c *ServerConn) hashCmd(path string, algo HashAlgo, start, end int64) (string, error) {
+	if !strings.EqualFold(c.hashAlgo, algo.String()) {
+		if _, _, err := c.cmd(StatusCommandOK, "OPTS HASH %s", algo); err != nil {
+			return "", err
+		}
+		c.hashAlgo = algo.String()
+	}
+
+	if end >= 0 {
+		// The end point of RANG is included
+		if _, _, err := c.cmd(StatusRequestFilePending, "RANG %d %d", start, end-1); err != nil {
+			return "", err
+		}
+	}
+
+	// The reply is "213 <algo> <start>-<end> <hash> <path>"
+	_, msg, err := c.cmd(StatusFile, "HASH %s", path)
+	if err != nil {
+		return "", err
+	}
+
+	fields := strings.Fields(msg)
+	if len(fields) < 3 {
+		return "", errors.New("unsupported HASH response format")
+	}
+	return strings.ToLower(fields[2]), nil
+}
+
+// hashSupported reports whether the algorithm is advertised for the HASH
+// command, as in "HASH SHA-1;SHA-256*;MD5" where the selected one is starred.
+func (c *ServerConn) hashSupported(algo HashAlgo) bool {
+	desc, ok := c.features["HASH"]
+	if !ok {
+		return false
+	}
+
+	supported := false
+	for _, name := range strings.Split(desc, ";") {
+		selected := strings.HasSuffix(name, "*")
+		name = strings.TrimSuffix(name, "*")
+		if selected && c.hashAlgo == "" {
+			c.hashAlgo = name
+		}
+		if strings.EqualFold(name, algo.String()) {
+			supported = true
+		}
+	}
+
+	return supported
+}
+
+// rangSupported reports whether the server supports the RANG command
+func (c *ServerConn) rangSupported() bool {
+	_, ok := c.features["RANG"]
+	return ok
+}
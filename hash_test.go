@@ -0,0 +1,72 @@
+package ftp
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSHA256 = "a6c39e3b0a5aab4b4dd1f5a5b6adc9cb75327e8a1c8e54e4c4d9f03d2be9bc7e"
+
+func TestHash(t *testing.T) {
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second))
+	c.features["HASH"] = "SHA-1*;SHA-256;MD5"
+
+	hash, err := c.Hash("magic-file", HashSHA256)
+	require.NoError(t, err)
+	assert.Equal(t, testSHA256, hash)
+
+	// the algorithm is only selected once
+	_, err = c.Hash("magic-file", HashSHA256)
+	require.NoError(t, err)
+
+	closeConn(t, mock, c, []string{"OPTS", "HASH", "HASH"})
+}
+
+func TestHashSelectedAlgo(t *testing.T) {
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second))
+	c.features["HASH"] = "SHA-1;SHA-256*;MD5"
+
+	_, err := c.Hash("magic-file", HashSHA256)
+	require.NoError(t, err)
+
+	closeConn(t, mock, c, []string{"HASH"})
+}
+
+func TestHashRange(t *testing.T) {
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second))
+	c.features["HASH"] = "SHA-256*"
+
+	// RANG is not supported
+	_, err := c.HashRange("magic-file", HashSHA256, 0, 42)
+	assert.True(t, errors.Is(err, ErrNotSupported))
+
+	c.features["RANG"] = "STREAM"
+	hash, err := c.HashRange("magic-file", HashSHA256, 0, 42)
+	require.NoError(t, err)
+	assert.Equal(t, testSHA256, hash)
+
+	_, err = c.HashRange("magic-file", HashSHA256, 42, 42)
+	assert.Error(t, err)
+
+	closeConn(t, mock, c, []string{"RANG", "HASH"})
+}
+
+func TestHashVendorCommand(t *testing.T) {
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second))
+	c.features["HASH"] = "SHA-256*"
+	c.features["XMD5"] = ""
+
+	hash, err := c.Hash("magic-file", HashMD5)
+	require.NoError(t, err)
+	assert.Equal(t, "b1946ac92492d2347c6235b4d2611184", hash)
+	assert.Equal(t, "XMD5 magic-file", mock.lastFull)
+
+	_, err = c.Hash("magic-file", HashSHA512)
+	assert.True(t, errors.Is(err, ErrNotSupported))
+
+	closeConn(t, mock, c, []string{"XMD5"})
+}
@@ -0,0 +1,90 @@
+package ftp
+
+import (
+	"sync"
+	"time"
+)
+
+// startKeepAlive starts the goroutine which sends NOOP on the idle control
+// connection, until Quit is called or the connection breaks.
+func (c *ServerConn) startKeepAlive(interval time.Duration) {
+	done := make(chan struct{})
+	var once sync.Once
+	c.stopKeepAlive = func() {
+		once.Do(func() { close(done) })
+	}
+
+	go c.keepAlive(interval, done)
+}
+
+func (c *ServerConn) keepAlive(interval time.Duration, done <-chan struct{}) {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-timer.C:
+		}
+
+		wait, ok, err := c.sendKeepAlive(interval)
+		if err != nil {
+			select {
+			case <-done:
+				// the failure is due to Quit
+			default:
+				if f := c.options.keepAliveErrorFunc; f != nil {
+					f(err)
+				}
+			}
+		}
+		if !ok {
+			return
+		}
+
+		timer.Reset(wait)
+	}
+}
+
+// sendKeepAlive sends NOOP if the control connection has been idle for the
+// interval, and returns the time to wait before the next attempt.
+// It returns false once the control connection is broken.
+func (c *ServerConn) sendKeepAlive(interval time.Duration) (time.Duration, bool, error) {
+	c.ioMu.Lock()
+	defer c.ioMu.Unlock()
+
+	c.mu.Lock()
+	idle := time.Since(c.lastUse)
+	busy := len(c.pending) > 0 || c.dataConn != nil
+	broken := c.broken
+	c.mu.Unlock()
+
+	switch {
+	case broken:
+		return 0, false, nil
+	case busy:
+		return interval, true, nil
+	case idle < interval:
+		return interval - idle, true, nil
+	}
+
+	// Any reply but 421 means the connection is alive, even if NOOP is
+	// refused before login
+	_, err := c.conn.Cmd("NOOP")
+	if err != nil {
+		c.setBroken()
+		return 0, false, err
+	}
+
+	code, msg, err := c.conn.ReadResponse(-1)
+	c.replied(false, code, err)
+	if err == nil && code == StatusNotAvailable {
+		err = command{name: "NOOP"}.error(code, msg)
+	}
+	if err != nil {
+		return 0, false, err
+	}
+
+	return interval, true, nil
+}
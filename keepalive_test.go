@@ -0,0 +1,108 @@
+package ftp
+
+import (
+	"bytes"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeepAliveSendsNoOp(t *testing.T) {
+	mock, c := openConn(t, "127.0.0.1", DialWithKeepAlive(20*time.Millisecond))
+
+	time.Sleep(70 * time.Millisecond)
+
+	require.NoError(t, c.Quit())
+	mock.Wait()
+
+	assert.Contains(t, mock.commands, "NOOP")
+}
+
+func TestKeepAliveDuringTransfer(t *testing.T) {
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second), DialWithKeepAlive(20*time.Millisecond))
+
+	r, err := c.Retr("big-file")
+	require.NoError(t, err)
+	time.Sleep(70 * time.Millisecond)
+	require.NoError(t, r.Abort())
+
+	require.NoError(t, c.Quit())
+	mock.Wait()
+
+	// the commands sent during the transfer are not interleaved with NOOP
+	var retr int
+	for i, cmd := range mock.commands {
+		if cmd == "RETR" {
+			retr = i
+		}
+	}
+	assert.Equal(t, "ABOR", mock.commands[retr+1])
+}
+
+func TestKeepAliveError(t *testing.T) {
+	errs := make(chan error, 1)
+	mock, c := openConn(t, "127.0.0.1",
+		DialWithKeepAlive(20*time.Millisecond),
+		DialWithKeepAliveErrorFunc(func(err error) { errs <- err }),
+	)
+
+	// drop the TCP session
+	require.NoError(t, c.netConn.Close())
+
+	select {
+	case err := <-errs:
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("the keepalive failure was not reported")
+	}
+	assert.True(t, c.isBroken())
+
+	mock.Wait()
+}
+
+// noopCountingConn counts the NOOP commands sent by the keepalive
+type noopCountingConn struct {
+	net.Conn
+	noops *int32
+}
+
+func (c noopCountingConn) Write(p []byte) (int, error) {
+	if bytes.HasPrefix(p, []byte("NOOP")) {
+		atomic.AddInt32(c.noops, 1)
+	}
+	return c.Conn.Write(p)
+}
+
+func TestKeepAliveConcurrentCommands(t *testing.T) {
+	var noops int32
+	dial := func(network, address string) (net.Conn, error) {
+		conn, err := net.Dial(network, address)
+		return noopCountingConn{conn, &noops}, err
+	}
+	interval := 100 * time.Microsecond
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second),
+		DialWithDialFunc(dial), DialWithKeepAlive(interval))
+
+	// A NOOP sent between a command and its reply would desynchronize them.
+	// The connection is left idle before the commands, so that the keepalive
+	// competes with them.
+	for i := 0; atomic.LoadInt32(&noops) < 100; i++ {
+		require.Less(t, i, 2000, "the keepalive did not send NOOP")
+		time.Sleep(time.Duration(i%7) * interval / 2)
+
+		size, err := c.FileSize("magic-file")
+		require.NoError(t, err)
+		require.Equal(t, int64(42), size)
+
+		dir, err := c.CurrentDir()
+		require.NoError(t, err)
+		require.Equal(t, "/incoming", dir)
+	}
+
+	require.NoError(t, c.Quit())
+	mock.Wait()
+}
@@ -0,0 +1,473 @@
+package ftp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MirrorOption represents an option of Mirror
+type MirrorOption struct {
+	setup func(mo *mirrorOptions)
+}
+
+// mirrorOptions contains all the options set by MirrorOption.setup
+type mirrorOptions struct {
+	include []string
+	exclude []string
+	delete  bool
+	dryRun  io.Writer
+}
+
+// MirrorWithInclude returns a MirrorOption that restricts the mirrored files
+// to those matching one of the patterns, see MirrorWithExclude for the syntax.
+// All the directories are mirrored, unless they are excluded.
+func MirrorWithInclude(patterns ...string) MirrorOption {
+	return MirrorOption{func(mo *mirrorOptions) {
+		mo.include = append(mo.include, patterns...)
+	}}
+}
+
+// MirrorWithExclude returns a MirrorOption that excludes the files and
+// directories matching one of the patterns. The patterns use the syntax of
+// path.Match and are matched against the slash-separated path relative to
+// the mirrored directory, and against the name of the file.
+//
+// The excluded files are neither transferred nor deleted.
+func MirrorWithExclude(patterns ...string) MirrorOption {
+	return MirrorOption{func(mo *mirrorOptions) {
+		mo.exclude = append(mo.exclude, patterns...)
+	}}
+}
+
+// MirrorWithDelete returns a MirrorOption that configures whether the files
+// and directories which do not exist in the source are deleted from the
+// destination. The default is false.
+func MirrorWithDelete(enabled bool) MirrorOption {
+	return MirrorOption{func(mo *mirrorOptions) {
+		mo.delete = enabled
+	}}
+}
+
+// MirrorWithDryRun returns a MirrorOption that makes a dry run: the destination
+// is left untouched and the planned actions are written to w, one per line,
+// such as "mkdir dir", "transfer dir/file" or "delete file". The summary
+// reports the planned actions.
+func MirrorWithDryRun(w io.Writer) MirrorOption {
+	return MirrorOption{func(mo *mirrorOptions) {
+		mo.dryRun = w
+	}}
+}
+
+func newMirrorOptions(options []MirrorOption) (*mirrorOptions, error) {
+	mo := &mirrorOptions{}
+	for _, option := range options {
+		option.setup(mo)
+	}
+
+	for _, patterns := range [][]string{mo.include, mo.exclude} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return mo, nil
+}
+
+// match reports whether the file or directory at the relative path is
+// mirrored
+func (mo *mirrorOptions) match(rel string, dir bool) bool {
+	for _, pattern := range mo.exclude {
+		if matchPattern(pattern, rel) {
+			return false
+		}
+	}
+
+	if dir || len(mo.include) == 0 {
+		return true
+	}
+	for _, pattern := range mo.include {
+		if matchPattern(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// planned reports whether the mirror is a dry run, in which case the action
+// is written instead of being done
+func (mo *mirrorOptions) planned(action, rel string) bool {
+	if mo.dryRun == nil {
+		return false
+	}
+	fmt.Fprintf(mo.dryRun, "%s %s\n", action, rel)
+	return true
+}
+
+func matchPattern(pattern, rel string) bool {
+	if ok, _ := path.Match(pattern, rel); ok {
+		return true
+	}
+	ok, _ := path.Match(pattern, path.Base(rel))
+	return ok
+}
+
+// MirrorSummary reports the outcome of a mirror. The paths are relative to
+// the mirrored directories.
+type MirrorSummary struct {
+	Transferred []string         // files transferred
+	Skipped     []string         // files already up to date
+	Deleted     []string         // files and directories deleted, see MirrorWithDelete
+	Failed      map[string]error // files and directories which could not be mirrored
+}
+
+func (s *MirrorSummary) fail(rel string, err error) {
+	if s.Failed == nil {
+		s.Failed = make(map[string]error)
+	}
+	s.Failed[rel] = err
+}
+
+// sameFile reports whether a file with the given size and modification
+// time is up to date. The time is ignored when it is unknown.
+//
+// The times listed by MLSD, when precise is true, are exact to the second.
+// LIST only gives the minute for the recent files, and only the day for the
+// others, which are listed at midnight.
+func sameFile(size int64, modTime time.Time, entry *Entry, precise bool) bool {
+	if size != int64(entry.Size) {
+		return false
+	}
+	if modTime.IsZero() || entry.Time.IsZero() {
+		return true
+	}
+
+	modTime = modTime.In(entry.Time.Location())
+	d := modTime.Sub(entry.Time)
+	switch {
+	case precise:
+		return d > -time.Second && d < time.Second
+	case entry.Time.Hour() == 0 && entry.Time.Minute() == 0 && entry.Time.Second() == 0:
+		y1, m1, d1 := modTime.Date()
+		y2, m2, d2 := entry.Time.Date()
+		return y1 == y2 && m1 == m2 && d1 == d2
+	}
+	return d >= 0 && d < time.Minute
+}
+
+// Mirror recreates the remote directory tree into the local directory. The
+// files which are missing locally, or whose size or modification time differ
+// from the remote Entry, are downloaded. Their modification time is then set
+// to the remote one.
+//
+// The failures to mirror a file are reported in the summary and the mirror
+// goes on, unless the control connection breaks or the walk fails.
+func (c *ServerConn) Mirror(remoteDir, localDir string, options ...MirrorOption) (*MirrorSummary, error) {
+	s := &MirrorSummary{}
+	mo, err := newMirrorOptions(options)
+	if err != nil {
+		return s, err
+	}
+
+	if _, err = os.Stat(localDir); err != nil && !mo.planned("mkdir", ".") {
+		if err = os.MkdirAll(localDir, 0755); err != nil {
+			return s, err
+		}
+	}
+
+	remote := make(map[string]bool)
+	w := c.Walk(remoteDir)
+	for w.Next() {
+		entry := w.Stat()
+		rel := strings.TrimPrefix(w.Path(), w.root)
+		dir := entry.Type == EntryTypeFolder
+
+		if !mo.match(rel, dir) {
+			if dir {
+				w.SkipDir()
+			}
+			continue
+		}
+		remote[rel] = true
+
+		local := filepath.Join(localDir, filepath.FromSlash(rel))
+		switch entry.Type {
+		case EntryTypeFolder:
+			if _, err = os.Stat(local); err == nil || mo.planned("mkdir", rel) {
+				continue
+			}
+			if err = os.MkdirAll(local, 0755); err != nil {
+				s.fail(rel, err)
+				w.SkipDir()
+			}
+		case EntryTypeFile:
+			if st, err := os.Stat(local); err == nil && st.Mode().IsRegular() && sameFile(st.Size(), st.ModTime(), entry, c.mlstSupported) {
+				s.Skipped = append(s.Skipped, rel)
+				continue
+			}
+
+			if mo.planned("transfer", rel) {
+				s.Transferred = append(s.Transferred, rel)
+				continue
+			}
+			if err = c.mirrorFile(w.Path(), local, entry); err != nil {
+				s.fail(rel, err)
+				if c.isBroken() {
+					return s, err
+				}
+				continue
+			}
+			s.Transferred = append(s.Transferred, rel)
+		}
+	}
+	if err = w.Err(); err != nil {
+		return s, err
+	}
+
+	// The local directory does not exist after a dry run, there is nothing
+	// to delete
+	if _, errStat := os.Stat(localDir); mo.delete && !os.IsNotExist(errStat) {
+		err = filepath.Walk(localDir, func(local string, info os.FileInfo, err error) error {
+			rel, errRel := filepath.Rel(localDir, local)
+			if errRel != nil || rel == "." {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+
+			if err != nil {
+				s.fail(rel, err)
+				return nil
+			}
+			switch {
+			case !mo.match(rel, info.IsDir()):
+				// The excluded files are kept
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			case remote[rel]:
+				return nil
+			}
+
+			if mo.planned("delete", rel) {
+				s.Deleted = append(s.Deleted, rel)
+			} else if err = os.RemoveAll(local); err != nil {
+				s.fail(rel, err)
+			} else {
+				s.Deleted = append(s.Deleted, rel)
+			}
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		})
+	}
+
+	return s, err
+}
+
+// mirrorFile downloads the remote file and sets its modification time
+func (c *ServerConn) mirrorFile(remote, local string, entry *Entry) error {
+	f, err := os.Create(local)
+	if err != nil {
+		return err
+	}
+
+	r, err := c.Retr(remote)
+	if err == nil {
+		if _, err = io.Copy(f, r); err != nil {
+			_ = r.Abort()
+		} else {
+			err = r.Close()
+		}
+	}
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		_ = os.Remove(local)
+		return err
+	}
+
+	if !entry.Time.IsZero() {
+		return os.Chtimes(local, entry.Time, entry.Time)
+	}
+	return nil
+}
+
+// MirrorUpload recreates the local directory tree into the remote directory.
+// The files which are missing on the server, or whose size or modification
+// time differ from the remote Entry, are uploaded. Their modification time is
+// then set with SetTime, when the server supports it. Without MLSD, the times
+// are compared at the precision of the listing, the minute or the day.
+//
+// The failures to mirror a file are reported in the summary and the mirror
+// goes on, unless the control connection breaks.
+func (c *ServerConn) MirrorUpload(localDir, remoteDir string, options ...MirrorOption) (*MirrorSummary, error) {
+	s := &MirrorSummary{}
+	mo, err := newMirrorOptions(options)
+	if err != nil {
+		return s, err
+	}
+
+	st, err := os.Stat(localDir)
+	if err != nil {
+		return s, err
+	}
+	if !st.IsDir() {
+		return s, fmt.Errorf("ftp: %s is not a directory", localDir)
+	}
+
+	entries, err := c.List(remoteDir)
+	if errors.Is(err, ErrNotFound) {
+		entries, err = nil, nil
+		if !mo.planned("mkdir", ".") {
+			err = c.MakeDir(remoteDir)
+		}
+	}
+	if err != nil {
+		return s, err
+	}
+
+	return s, c.mirrorUploadDir(mo, s, localDir, remoteDir, ".", entries)
+}
+
+// mirrorUploadDir uploads the content of the local directory into the remote
+// one, whose entries are given
+func (c *ServerConn) mirrorUploadDir(mo *mirrorOptions, s *MirrorSummary, localDir, remoteDir, rel string, entries []*Entry) error {
+	// fail records the failure, which stops the mirror if the connection broke
+	fail := func(rel string, err error) error {
+		s.fail(rel, err)
+		if c.isBroken() {
+			return err
+		}
+		return nil
+	}
+
+	infos, err := ioutil.ReadDir(localDir)
+	if err != nil {
+		return fail(rel, err)
+	}
+
+	remote := make(map[string]*Entry, len(entries))
+	for _, entry := range entries {
+		if entry.Name != "." && entry.Name != ".." {
+			remote[entry.Name] = entry
+		}
+	}
+
+	for _, info := range infos {
+		name := info.Name()
+		relName := path.Join(rel, name)
+		if !mo.match(relName, info.IsDir()) {
+			continue
+		}
+
+		entry := remote[name]
+		delete(remote, name)
+		local := filepath.Join(localDir, name)
+		remotePath := path.Join(remoteDir, name)
+
+		switch {
+		case info.IsDir():
+			var children []*Entry
+			switch {
+			case entry == nil:
+				if !mo.planned("mkdir", relName) {
+					err = c.MakeDir(remotePath)
+				}
+			case entry.Type != EntryTypeFolder:
+				err = fmt.Errorf("ftp: %s is not a directory", remotePath)
+			default:
+				children, err = c.List(remotePath)
+			}
+			if err != nil {
+				if err = fail(relName, err); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err = c.mirrorUploadDir(mo, s, local, remotePath, relName, children); err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			if entry != nil && entry.Type == EntryTypeFile && sameFile(info.Size(), info.ModTime(), entry, c.mlstSupported) {
+				s.Skipped = append(s.Skipped, relName)
+				continue
+			}
+			if mo.planned("transfer", relName) {
+				s.Transferred = append(s.Transferred, relName)
+				continue
+			}
+
+			if err = c.mirrorUploadFile(local, remotePath, info.ModTime()); err != nil {
+				if err = fail(relName, err); err != nil {
+					return err
+				}
+				continue
+			}
+			s.Transferred = append(s.Transferred, relName)
+		}
+	}
+
+	if !mo.delete {
+		return nil
+	}
+
+	names := make([]string, 0, len(remote))
+	for name := range remote {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		entry := remote[name]
+		relName := path.Join(rel, name)
+		// The excluded files are kept
+		if !mo.match(relName, entry.Type == EntryTypeFolder) {
+			continue
+		}
+
+		if !mo.planned("delete", relName) {
+			remotePath := path.Join(remoteDir, name)
+			// RemoveDirRecur would leave the current directory changed
+			if err = c.removeAll(remotePath, entry); err != nil {
+				if err = fail(relName, err); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		s.Deleted = append(s.Deleted, relName)
+	}
+	return nil
+}
+
+// mirrorUploadFile uploads the local file and sets its modification time
+func (c *ServerConn) mirrorUploadFile(local, remote string, modTime time.Time) error {
+	f, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err = c.Stor(remote, f); err != nil {
+		return err
+	}
+
+	// The modification time is not kept if the server cannot set it
+	if err = c.SetTime(remote, modTime); err != nil && !errors.Is(err, ErrNotSupported) {
+		return err
+	}
+	return nil
+}
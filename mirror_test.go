@@ -0,0 +1,219 @@
+package ftp
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mirrorTime is the time of the files listed under /mirror by the mock
+var mirrorTime = time.Date(2020, 1, 29, 0, 0, 0, 0, time.UTC)
+
+func dialTestMirror(t *testing.T) (*mockDialer, *ServerConn) {
+	d := &mockDialer{t: t}
+	c, err := dialLogin(context.Background(), poolAddr, "anonymous", "anonymous",
+		[]DialOption{DialWithTimeout(5 * time.Second), DialWithDialFunc(d.dial)})
+	require.NoError(t, err)
+	return d, c
+}
+
+func TestMirror(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	d, c := dialTestMirror(t)
+
+	s, err := c.Mirror("/mirror", dir)
+	require.NoError(t, err)
+	sort.Strings(s.Transferred)
+	assert.Equal(t, []string{"dir/sub-file", "file", "notes.tmp"}, s.Transferred)
+	assert.Empty(t, s.Failed)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "dir", "sub-file"))
+	require.NoError(t, err)
+	assert.Equal(t, testData, string(data))
+	st, err := os.Stat(filepath.Join(dir, "file"))
+	require.NoError(t, err)
+	assert.True(t, st.ModTime().Equal(mirrorTime))
+
+	// the files are up to date
+	s, err = c.Mirror("/mirror", dir)
+	require.NoError(t, err)
+	assert.Empty(t, s.Transferred)
+	assert.Len(t, s.Skipped, 3)
+
+	require.NoError(t, c.Quit())
+	d.mocks[0].Wait()
+	assert.Equal(t, 3, count(d.mocks[0].commands, "RETR"))
+}
+
+func TestMirrorExcludeDelete(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "old", "sub"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "old", "sub", "a"), nil, 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "extra"), nil, 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "keep.tmp"), nil, 0644))
+
+	_, c := dialTestMirror(t)
+
+	s, err := c.Mirror("/mirror", dir, MirrorWithExclude("*.tmp"), MirrorWithDelete(true))
+	require.NoError(t, err)
+	sort.Strings(s.Transferred)
+	sort.Strings(s.Deleted)
+	assert.Equal(t, []string{"dir/sub-file", "file"}, s.Transferred)
+	assert.Equal(t, []string{"extra", "old"}, s.Deleted)
+
+	assert.NoFileExists(t, filepath.Join(dir, "notes.tmp"))
+	assert.FileExists(t, filepath.Join(dir, "keep.tmp"))
+	assert.NoDirExists(t, filepath.Join(dir, "old"))
+
+	require.NoError(t, c.Quit())
+}
+
+func TestMirrorInclude(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	_, c := dialTestMirror(t)
+
+	s, err := c.Mirror("/mirror", dir, MirrorWithInclude("sub-*"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dir/sub-file"}, s.Transferred)
+
+	_, err = c.Mirror("/mirror", dir, MirrorWithInclude("["))
+	assert.Error(t, err)
+
+	require.NoError(t, c.Quit())
+}
+
+func TestMirrorUpload(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "dir"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "new"), 0755))
+	// the listing only gives the day of file
+	modTime := mirrorTime.Add(15*time.Hour + 7*time.Minute)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "file"), []byte(testData), 0644))
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "file"), modTime, modTime))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "dir", "sub-file"), []byte("changed"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "new", "x"), []byte(testData), 0644))
+
+	d, c := dialTestMirror(t)
+	c.mfmtSupported = true
+
+	s, err := c.MirrorUpload(dir, "/mirror", MirrorWithDelete(true))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dir/sub-file", "new/x"}, s.Transferred)
+	assert.Equal(t, []string{"file"}, s.Skipped)
+	assert.Equal(t, []string{"notes.tmp"}, s.Deleted)
+	assert.Empty(t, s.Failed)
+
+	require.NoError(t, c.Quit())
+	d.mocks[0].Wait()
+	assert.Equal(t, 2, count(d.mocks[0].commands, "STOR"))
+	assert.Equal(t, 2, count(d.mocks[0].commands, "MFMT"))
+	assert.Equal(t, 1, count(d.mocks[0].commands, "MKD"))
+	assert.Equal(t, 1, count(d.mocks[0].commands, "DELE"))
+}
+
+func TestMirrorUploadDeleteDir(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "file"), []byte(testData), 0644))
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "file"), mirrorTime, mirrorTime))
+
+	d, c := dialTestMirror(t)
+
+	s, err := c.MirrorUpload(dir, "/mirror", MirrorWithDelete(true))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dir", "notes.tmp"}, s.Deleted)
+	assert.Empty(t, s.Failed)
+
+	require.NoError(t, c.Quit())
+	d.mocks[0].Wait()
+
+	// the directory is removed without changing the current directory
+	assert.NotContains(t, d.mocks[0].commands, "CWD")
+	assert.NotContains(t, d.mocks[0].commands, "CDUP")
+	assert.Equal(t, 2, count(d.mocks[0].commands, "DELE"))
+	assert.Equal(t, 1, count(d.mocks[0].commands, "RMD"))
+}
+
+func TestSameFile(t *testing.T) {
+	recent := &Entry{Size: 14, Time: time.Date(2020, 12, 13, 20, 24, 0, 0, time.UTC)}
+	old := &Entry{Size: 14, Time: mirrorTime}
+
+	for _, tt := range []struct {
+		modTime time.Time
+		entry   *Entry
+		precise bool
+		same    bool
+	}{
+		{recent.Time.Add(45 * time.Second), recent, false, true},
+		{recent.Time.Add(45 * time.Second), recent, true, false},
+		{recent.Time.Add(500 * time.Millisecond), recent, true, true},
+		{recent.Time.Add(2 * time.Minute), recent, false, false},
+		{recent.Time.In(time.FixedZone("UTC+2", 2*3600)), recent, false, true},
+		{mirrorTime.Add(23 * time.Hour), old, false, true},
+		{mirrorTime.Add(25 * time.Hour), old, false, false},
+		{time.Time{}, recent, false, true},
+	} {
+		assert.Equal(t, tt.same, sameFile(14, tt.modTime, tt.entry, tt.precise), "%v %v", tt.modTime, tt.precise)
+	}
+	assert.False(t, sameFile(15, recent.Time, recent, true))
+}
+
+func TestMirrorDryRun(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "new"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "new", "x"), []byte(testData), 0644))
+
+	d, c := dialTestMirror(t)
+
+	buf := &bytes.Buffer{}
+	s, err := c.MirrorUpload(dir, "/mirror", MirrorWithDryRun(buf), MirrorWithDelete(true))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"new/x"}, s.Transferred)
+	assert.Equal(t, []string{"dir", "file", "notes.tmp"}, s.Deleted)
+	assert.Equal(t, "mkdir new\ntransfer new/x\ndelete dir\ndelete file\ndelete notes.tmp\n", buf.String())
+
+	buf.Reset()
+	local := filepath.Join(dir, "local")
+	s, err = c.Mirror("/mirror", local, MirrorWithDryRun(buf), MirrorWithDelete(true))
+	require.NoError(t, err)
+	assert.Len(t, s.Transferred, 3)
+	assert.Contains(t, buf.String(), "mkdir .\n")
+	assert.Contains(t, buf.String(), "transfer dir/sub-file\n")
+	assert.Empty(t, s.Deleted)
+	assert.NoDirExists(t, local)
+
+	require.NoError(t, c.Quit())
+	d.mocks[0].Wait()
+	for _, cmd := range []string{"STOR", "RETR", "MKD", "DELE", "RMD"} {
+		assert.NotContains(t, d.mocks[0].commands, cmd)
+	}
+}
+
+func count(commands []string, command string) int {
+	n := 0
+	for _, cmd := range commands {
+		if cmd == command {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,223 @@
+package ftp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+// DownloadOption represents an option of DownloadParallel
+type DownloadOption struct {
+	setup func(do *downloadOptions)
+}
+
+// downloadOptions contains all the options set by DownloadOption.setup
+type downloadOptions struct {
+	maxAttempts int
+	progress    func(done, total int64)
+}
+
+// DownloadWithMaxAttempts returns a DownloadOption that configures the number
+// of times the transfer of a segment is attempted, the first one included.
+// The default is 3.
+func DownloadWithMaxAttempts(n int) DownloadOption {
+	return DownloadOption{func(do *downloadOptions) {
+		do.maxAttempts = n
+	}}
+}
+
+// DownloadWithProgress returns a DownloadOption that configures
+// DownloadParallel to call f with the number of bytes downloaded so far
+// and the size of the file, each time a segment makes progress.
+// The calls are not concurrent.
+func DownloadWithProgress(f func(done, total int64)) DownloadOption {
+	return DownloadOption{func(do *downloadOptions) {
+		do.progress = f
+	}}
+}
+
+// DownloadParallel downloads the file into dst over n additional sessions,
+// opened with the dial options and credentials of c. The file is split into
+// n segments, each one is fetched with RetrFrom and written at its offset.
+//
+// A segment is resumed where it stopped when its transfer fails with a
+// network error or a transient negative reply, see DownloadWithMaxAttempts.
+// The first error which cannot be retried stops the download.
+func (c *ServerConn) DownloadParallel(path string, dst io.WriterAt, n int, options ...DownloadOption) error {
+	return c.DownloadParallelContext(context.Background(), path, dst, n, options...)
+}
+
+// DownloadParallelContext is like DownloadParallel but the download is
+// interrupted when ctx is done.
+func (c *ServerConn) DownloadParallelContext(ctx context.Context, path string, dst io.WriterAt, n int, options ...DownloadOption) error {
+	do := &downloadOptions{maxAttempts: 3}
+	for _, option := range options {
+		option.setup(do)
+	}
+	if n < 1 {
+		n = 1
+	}
+
+	size, err := c.FileSizeContext(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	d := &parallelDownload{
+		c:       c,
+		path:    path,
+		dst:     dst,
+		size:    size,
+		options: do,
+	}
+
+	// The segments are rounded up so that there are at most n of them
+	segment := (size + int64(n) - 1) / int64(n)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for start := int64(0); start < size; start += segment {
+		end := start + segment
+		if end > size {
+			end = size
+		}
+
+		wg.Add(1)
+		go func(start, end int64) {
+			defer wg.Done()
+			if err := d.download(ctx, start, end); err != nil {
+				errs <- err
+				cancel()
+			}
+		}(start, end)
+	}
+	wg.Wait()
+
+	select {
+	case err = <-errs:
+		return err
+	default:
+		return nil
+	}
+}
+
+// parallelDownload is the state of DownloadParallel
+type parallelDownload struct {
+	c       *ServerConn
+	path    string
+	dst     io.WriterAt
+	size    int64
+	options *downloadOptions
+
+	mu   sync.Mutex // protects done and serializes the progress calls
+	done int64
+}
+
+// download fetches the bytes from start to end, excluded, over a new session
+func (d *parallelDownload) download(ctx context.Context, start, end int64) error {
+	var s *ServerConn
+	defer func() {
+		if s != nil {
+			_ = s.Quit()
+		}
+	}()
+
+	offset := start
+	for attempt := 1; ; attempt++ {
+		var err error
+		if s == nil || s.isBroken() {
+			if s != nil {
+				_ = s.Quit()
+			}
+			s, err = d.c.openSession(ctx)
+		}
+		if err == nil {
+			err = d.copy(ctx, s, &offset, end)
+		}
+		if err == nil {
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if attempt >= d.options.maxAttempts || !retryable(s, err) {
+			return err
+		}
+	}
+}
+
+// copy transfers the segment from offset to end, and advances offset
+func (d *parallelDownload) copy(ctx context.Context, s *ServerConn, offset *int64, end int64) error {
+	r, err := s.RetrFromContext(ctx, d.path, uint64(*offset))
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, 32*1024)
+	for *offset < end {
+		if remaining := end - *offset; remaining < int64(len(buf)) {
+			buf = buf[:remaining]
+		}
+
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, errWrite := d.dst.WriteAt(buf[:n], *offset); errWrite != nil {
+				_ = r.Abort()
+				return errWrite
+			}
+			*offset += int64(n)
+			d.progress(int64(n))
+		}
+
+		if err == io.EOF && *offset < end {
+			// The final reply tells why the transfer stopped early
+			if err = r.Close(); err == nil {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		if err != nil && err != io.EOF {
+			_ = r.Abort()
+			return err
+		}
+	}
+
+	// The rest of the file is fetched by the next segments
+	if end < d.size {
+		return r.Abort()
+	}
+	return r.Close()
+}
+
+// progress records that n more bytes were downloaded
+func (d *parallelDownload) progress(n int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.done += n
+	if d.options.progress != nil {
+		d.options.progress(d.done, d.size)
+	}
+}
+
+// retryable reports whether a transfer which failed with err can be resumed:
+// after a network error, a transient negative reply or a truncated transfer.
+func retryable(s *ServerConn, err error) bool {
+	if s != nil && s.isBroken() {
+		return true
+	}
+
+	var ftpErr *Error
+	if errors.As(err, &ftpErr) {
+		return ftpErr.Temporary()
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || err == io.ErrUnexpectedEOF
+}
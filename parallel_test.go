@@ -0,0 +1,84 @@
+package ftp
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memWriterAt is an io.WriterAt writing into a byte slice
+type memWriterAt struct {
+	mu  sync.Mutex
+	buf []byte
+}
+
+func (w *memWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if end := int(off) + len(p); end > len(w.buf) {
+		w.buf = append(w.buf, make([]byte, end-len(w.buf))...)
+	}
+	return copy(w.buf[off:], p), nil
+}
+
+func dialTestParallel(t *testing.T, size int) (*mockDialer, *ServerConn) {
+	d := &mockDialer{t: t, data: make([]byte, size)}
+	rand.New(rand.NewSource(1)).Read(d.data)
+
+	c, err := dialLogin(context.Background(), poolAddr, "anonymous", "anonymous",
+		[]DialOption{DialWithTimeout(5 * time.Second), DialWithDialFunc(d.dial)})
+	require.NoError(t, err)
+	return d, c
+}
+
+func TestDownloadParallel(t *testing.T) {
+	d, c := dialTestParallel(t, 300*1024)
+
+	var mu sync.Mutex
+	var done, total int64
+	progress := func(n, size int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.True(t, n > done)
+		done, total = n, size
+	}
+
+	w := &memWriterAt{}
+	err := c.DownloadParallel("data-file", w, 4, DownloadWithProgress(progress))
+	require.NoError(t, err)
+	assert.Equal(t, d.data, w.buf)
+	assert.Equal(t, int64(len(d.data)), done)
+	assert.Equal(t, int64(len(d.data)), total)
+
+	// the main connection and one session per segment
+	assert.Equal(t, 5, d.count())
+	require.NoError(t, c.Quit())
+}
+
+func TestDownloadParallelRetry(t *testing.T) {
+	d, c := dialTestParallel(t, 100*1024)
+
+	w := &memWriterAt{}
+	err := c.DownloadParallel("flaky-file", w, 2)
+	require.NoError(t, err)
+	assert.Equal(t, d.data, w.buf)
+
+	// the segments are resumed over the same sessions
+	assert.Equal(t, 3, d.count())
+	require.NoError(t, c.Quit())
+}
+
+func TestDownloadParallelNotFound(t *testing.T) {
+	_, c := dialTestParallel(t, 1024)
+
+	err := c.DownloadParallel("missing-file", &memWriterAt{}, 2)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	require.NoError(t, c.Quit())
+}
@@ -0,0 +1,258 @@
+package ftp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrPoolClosed is returned by Pool.Get once the pool is closed.
+var ErrPoolClosed = errors.New("ftp: pool closed")
+
+// Pool maintains a set of authenticated connections to a single FTP server,
+// so that several goroutines can work with the server concurrently.
+//
+// A connection is checked out with Get and must be given back with Put
+// once the caller is done with it. Each connection is still used by a single
+// goroutine at a time.
+type Pool struct {
+	addr     string
+	user     string
+	password string
+	options  *poolOptions
+
+	sem chan struct{} // one token per open connection, nil if unlimited
+
+	mu     sync.Mutex // protects idle and closed
+	idle   []*idleConn
+	closed bool
+}
+
+// idleConn is a connection waiting in the pool
+type idleConn struct {
+	c     *ServerConn
+	since time.Time
+}
+
+// PoolOption represents an option to create a Pool with NewPool
+type PoolOption struct {
+	setup func(po *poolOptions)
+}
+
+// poolOptions contains all the options set by PoolOption.setup
+type poolOptions struct {
+	maxOpen     int
+	maxIdle     int
+	idleTimeout time.Duration
+	dialOptions []DialOption
+}
+
+// PoolWithMaxOpen returns a PoolOption that limits the number of connections
+// opened by the Pool, checked out or idle. Get waits for a connection to be
+// put back when the limit is reached. Zero means no limit.
+func PoolWithMaxOpen(n int) PoolOption {
+	return PoolOption{func(po *poolOptions) {
+		po.maxOpen = n
+	}}
+}
+
+// PoolWithMaxIdle returns a PoolOption that limits the number of idle
+// connections kept by the Pool. The default is 2.
+func PoolWithMaxIdle(n int) PoolOption {
+	return PoolOption{func(po *poolOptions) {
+		po.maxIdle = n
+	}}
+}
+
+// PoolWithIdleTimeout returns a PoolOption that configures the Pool to close
+// the connections which have been idle for longer than the timeout.
+// Zero means idle connections are kept until they fail the health check.
+func PoolWithIdleTimeout(timeout time.Duration) PoolOption {
+	return PoolOption{func(po *poolOptions) {
+		po.idleTimeout = timeout
+	}}
+}
+
+// PoolWithDialOptions returns a PoolOption that configures the Pool to open
+// its connections with the given DialOptions.
+func PoolWithDialOptions(options ...DialOption) PoolOption {
+	return PoolOption{func(po *poolOptions) {
+		po.dialOptions = append(po.dialOptions, options...)
+	}}
+}
+
+// NewPool returns a Pool of connections to the specified address, logged in
+// with the given credentials. Connections are opened on demand.
+func NewPool(addr, user, password string, options ...PoolOption) *Pool {
+	po := &poolOptions{maxIdle: 2}
+	for _, option := range options {
+		option.setup(po)
+	}
+
+	p := &Pool{
+		addr:     addr,
+		user:     user,
+		password: password,
+		options:  po,
+	}
+	if po.maxOpen > 0 {
+		p.sem = make(chan struct{}, po.maxOpen)
+	}
+
+	return p
+}
+
+// Get checks out a connection from the Pool. An idle connection is reused
+// if it answers to NOOP, otherwise a new connection is opened.
+//
+// The context bounds the time spent waiting for a connection, checking it
+// and opening a new one.
+func (p *Pool) Get(ctx context.Context) (*ServerConn, error) {
+	if p.sem != nil {
+		select {
+		case p.sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	for {
+		c, err := p.popIdle()
+		if err != nil {
+			p.release()
+			return nil, err
+		}
+		if c == nil {
+			break
+		}
+
+		if err = c.NoOpContext(ctx); err == nil {
+			return c, nil
+		}
+		_ = c.Quit()
+	}
+
+	c, err := dialLogin(ctx, p.addr, p.user, p.password, p.options.dialOptions)
+	if err != nil {
+		p.release()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Put gives back a connection checked out with Get. Broken connections,
+// for example after a 421 reply or a network error, are closed instead of
+// being reused.
+//
+// The connection must not be used after Put.
+func (p *Pool) Put(c *ServerConn) {
+	idle := !c.isBroken() && c.pendingReplies() == 0
+
+	p.mu.Lock()
+	reuse := idle && !p.closed && len(p.idle) < p.options.maxIdle
+	if reuse {
+		p.idle = append(p.idle, &idleConn{c: c, since: time.Now()})
+	}
+	p.mu.Unlock()
+
+	if !reuse {
+		_ = c.Quit()
+	}
+	p.release()
+}
+
+// Close closes the idle connections of the Pool. The connections checked
+// out are closed when they are put back.
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.closed = true
+	p.mu.Unlock()
+
+	var err error
+	for _, ic := range idle {
+		if errQuit := ic.c.Quit(); err == nil {
+			err = errQuit
+		}
+	}
+
+	return err
+}
+
+// popIdle returns the most recently used idle connection, or nil if there
+// is none. The connections idle for too long are closed.
+func (p *Pool) popIdle() (*ServerConn, error) {
+	var expired []*ServerConn
+	defer func() {
+		for _, c := range expired {
+			_ = c.Quit()
+		}
+	}()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, ErrPoolClosed
+	}
+
+	for len(p.idle) > 0 {
+		i := len(p.idle) - 1
+		ic := p.idle[i]
+		p.idle = p.idle[:i]
+
+		if p.options.idleTimeout > 0 && time.Since(ic.since) > p.options.idleTimeout {
+			expired = append(expired, ic.c)
+			continue
+		}
+
+		return ic.c, nil
+	}
+
+	return nil, nil
+}
+
+// release frees the slot of a connection which was closed or put back
+func (p *Pool) release() {
+	if p.sem != nil {
+		<-p.sem
+	}
+}
+
+// dialLogin connects to the specified address, logs in and completes the
+// session setup with AfterAuth.
+func dialLogin(ctx context.Context, addr, user, password string, options []DialOption) (*ServerConn, error) {
+	options = append(options[:len(options):len(options)], DialWithContext(ctx))
+
+	c, err := Dial(addr, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := c.AuthContext(ctx, user, password)
+	if err == nil && code != StatusLoggedIn {
+		err = command{name: "USER"}.error(code, StatusText(code))
+	}
+	if err == nil {
+		err = c.AfterAuthContext(ctx)
+	}
+	if err != nil {
+		_ = c.Quit()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// openSession opens a new session to the server of c, with the same dial
+// options and credentials.
+func (c *ServerConn) openSession(ctx context.Context) (*ServerConn, error) {
+	if c.options.conn != nil {
+		return nil, errors.New("ftp: cannot open a new session with DialWithNetConn")
+	}
+
+	return dialLogin(ctx, c.addr, c.user, c.password, c.dialArgs)
+}
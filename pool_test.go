@@ -0,0 +1,112 @@
+package ftp
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// poolAddr is the address dialed by the test pools, each control connection
+// to it is served by a new mock server
+const poolAddr = "pool.test:21"
+
+// newTestPool returns a Pool whose connections are served by new mock servers
+func newTestPool(t *testing.T, options ...PoolOption) *Pool {
+	dial := func(network, address string) (net.Conn, error) {
+		if address != poolAddr {
+			return net.Dial(network, address)
+		}
+
+		mock, err := newFtpMock(t, "127.0.0.1")
+		if err != nil {
+			return nil, err
+		}
+		return net.Dial(network, mock.Addr())
+	}
+
+	options = append(options, PoolWithDialOptions(DialWithTimeout(5*time.Second), DialWithDialFunc(dial)))
+	return NewPool(poolAddr, "anonymous", "anonymous", options...)
+}
+
+func TestPoolReusesConnections(t *testing.T) {
+	p := newTestPool(t)
+	defer p.Close()
+
+	c1, err := p.Get(context.Background())
+	require.NoError(t, err)
+	p.Put(c1)
+
+	c2, err := p.Get(context.Background())
+	require.NoError(t, err)
+	assert.True(t, c1 == c2, "the idle connection must be reused")
+
+	c3, err := p.Get(context.Background())
+	require.NoError(t, err)
+	assert.False(t, c2 == c3, "a checked out connection must not be shared")
+
+	p.Put(c2)
+	p.Put(c3)
+}
+
+func TestPoolMaxOpen(t *testing.T) {
+	p := newTestPool(t, PoolWithMaxOpen(1))
+	defer p.Close()
+
+	c, err := p.Get(context.Background())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = p.Get(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	p.Put(c)
+
+	c, err = p.Get(context.Background())
+	require.NoError(t, err)
+	p.Put(c)
+}
+
+func TestPoolDiscardsBrokenConnections(t *testing.T) {
+	p := newTestPool(t)
+	defer p.Close()
+
+	c1, err := p.Get(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, c1.Quit())
+	p.Put(c1)
+
+	c2, err := p.Get(context.Background())
+	require.NoError(t, err)
+	assert.False(t, c1 == c2, "a broken connection must not be reused")
+	assert.NoError(t, c2.NoOp())
+	p.Put(c2)
+}
+
+func TestPoolIdleTimeout(t *testing.T) {
+	p := newTestPool(t, PoolWithIdleTimeout(time.Millisecond))
+	defer p.Close()
+
+	c1, err := p.Get(context.Background())
+	require.NoError(t, err)
+	p.Put(c1)
+
+	time.Sleep(5 * time.Millisecond)
+
+	c2, err := p.Get(context.Background())
+	require.NoError(t, err)
+	assert.False(t, c1 == c2, "an expired connection must not be reused")
+	p.Put(c2)
+}
+
+func TestPoolClosed(t *testing.T) {
+	p := newTestPool(t)
+	require.NoError(t, p.Close())
+
+	_, err := p.Get(context.Background())
+	assert.Equal(t, ErrPoolClosed, err)
+}
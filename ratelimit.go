@@ -0,0 +1,147 @@
+package ftp
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// RateLimiter limits a throughput with a token bucket: up to burst bytes
+// can be transferred at once, then the bucket refills at the given rate.
+// It is safe for concurrent use, see DialWithDownloadLimiter and
+// DialWithUploadLimiter.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // bytes per second, 0 if unlimited
+	burst  int
+	tokens float64 // negative when transfers wait for the bucket to refill
+	last   time.Time
+}
+
+// NewRateLimiter returns a RateLimiter allowing bytesPerSec bytes per second,
+// with bursts of up to burst bytes. If burst is not positive, it is a second
+// worth of data. A limit of 0 is no limit.
+func NewRateLimiter(bytesPerSec, burst int) *RateLimiter {
+	l := &RateLimiter{}
+	l.SetLimit(bytesPerSec, burst)
+	l.tokens = float64(l.burst)
+	return l
+}
+
+// SetLimit changes the limits of the RateLimiter, see NewRateLimiter. The
+// transfers in progress use the new limits for their next reads and writes.
+func (l *RateLimiter) SetLimit(bytesPerSec, burst int) {
+	if bytesPerSec < 0 {
+		bytesPerSec = 0
+	}
+	if burst <= 0 {
+		burst = bytesPerSec
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(time.Now())
+	l.rate = float64(bytesPerSec)
+	l.burst = burst
+	if l.tokens > float64(burst) {
+		l.tokens = float64(burst)
+	}
+}
+
+// Limit returns the current limits of the RateLimiter.
+func (l *RateLimiter) Limit() (bytesPerSec, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.rate), l.burst
+}
+
+// refill adds the tokens earned since the last refill
+func (l *RateLimiter) refill(now time.Time) {
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > float64(l.burst) {
+			l.tokens = float64(l.burst)
+		}
+	}
+	l.last = now
+}
+
+// chunk returns how many of the n bytes can be transferred at once
+func (l *RateLimiter) chunk(n int) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate > 0 && n > l.burst {
+		return l.burst
+	}
+	return n
+}
+
+// wait takes n tokens from the bucket, and sleeps until the bucket is no
+// longer in debt
+func (l *RateLimiter) wait(n int) {
+	l.mu.Lock()
+	if l.rate <= 0 || n <= 0 {
+		l.mu.Unlock()
+		return
+	}
+
+	l.refill(time.Now())
+	l.tokens -= float64(n)
+	var d time.Duration
+	if l.tokens < 0 {
+		d = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	time.Sleep(d)
+}
+
+// limitedConn is a data connection whose throughput is limited
+type limitedConn struct {
+	net.Conn
+	read  *RateLimiter
+	write *RateLimiter
+}
+
+// limitDataConn applies the limiters of the options to the data connection
+func (c *ServerConn) limitDataConn(conn net.Conn) net.Conn {
+	if c.options.downloadLimiter == nil && c.options.uploadLimiter == nil {
+		return conn
+	}
+
+	return &limitedConn{
+		Conn:  conn,
+		read:  c.options.downloadLimiter,
+		write: c.options.uploadLimiter,
+	}
+}
+
+func (lc *limitedConn) Read(buf []byte) (int, error) {
+	if lc.read == nil {
+		return lc.Conn.Read(buf)
+	}
+
+	n, err := lc.Conn.Read(buf[:lc.read.chunk(len(buf))])
+	lc.read.wait(n)
+	return n, err
+}
+
+func (lc *limitedConn) Write(buf []byte) (int, error) {
+	if lc.write == nil {
+		return lc.Conn.Write(buf)
+	}
+
+	written := 0
+	for written < len(buf) {
+		n := lc.write.chunk(len(buf) - written)
+		lc.write.wait(n)
+		n, err := lc.Conn.Write(buf[written : written+n])
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
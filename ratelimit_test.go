@@ -0,0 +1,61 @@
+package ftp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := NewRateLimiter(10000, 1000)
+	assert.Equal(t, 1000, l.chunk(5000))
+
+	// the burst is available right away
+	start := time.Now()
+	l.wait(1000)
+	assert.True(t, time.Since(start) < 50*time.Millisecond)
+
+	start = time.Now()
+	l.wait(1000)
+	assert.True(t, time.Since(start) >= 90*time.Millisecond)
+
+	l.SetLimit(0, 0)
+	assert.Equal(t, 5000, l.chunk(5000))
+	start = time.Now()
+	l.wait(1000000)
+	assert.True(t, time.Since(start) < 50*time.Millisecond)
+
+	l.SetLimit(2000, 0)
+	rate, burst := l.Limit()
+	assert.Equal(t, 2000, rate)
+	assert.Equal(t, 2000, burst)
+}
+
+func TestRateLimitedTransfers(t *testing.T) {
+	download := NewRateLimiter(100000, 10000)
+	upload := NewRateLimiter(100000, 10000)
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second),
+		DialWithDownloadLimiter(download), DialWithUploadLimiter(upload))
+
+	data := bytes.Repeat([]byte("0123456789"), 3000)
+
+	// 20000 bytes over the burst at 100000 bytes per second
+	start := time.Now()
+	require.NoError(t, c.Stor("test", bytes.NewReader(data)))
+	assert.True(t, time.Since(start) >= 180*time.Millisecond)
+
+	start = time.Now()
+	r, err := c.Retr("test")
+	require.NoError(t, err)
+	buf, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	assert.Equal(t, data, buf)
+	assert.True(t, time.Since(start) >= 180*time.Millisecond)
+
+	closeConn(t, mock, c, []string{"EPSV", "STOR", "EPSV", "RETR"})
+}
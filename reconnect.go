@@ -0,0 +1,357 @@
+package ftp
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// ReconnectingConn is a connection to a FTP server which is re-established
+// when it breaks, for example after a "421 Timeout" reply or when the TCP
+// session is dropped.
+//
+// The new connection is logged in with the same credentials, and the
+// current directory and the capabilities discovered at runtime are restored.
+// The idempotent operations are retried according to the retry policy, the
+// others are only sent once.
+//
+// Like ServerConn, a ReconnectingConn is not safe to be called concurrently.
+type ReconnectingConn struct {
+	addr     string
+	user     string
+	password string
+	options  *reconnectOptions
+
+	c   *ServerConn
+	dir string // current directory, restored after reconnecting
+}
+
+// ReconnectOption represents an option to create a ReconnectingConn with
+// DialReconnecting
+type ReconnectOption struct {
+	setup func(ro *reconnectOptions)
+}
+
+// reconnectOptions contains all the options set by ReconnectOption.setup
+type reconnectOptions struct {
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	dialOptions []DialOption
+}
+
+// ReconnectWithMaxAttempts returns a ReconnectOption that configures the number
+// of times an idempotent operation is attempted, the first one included.
+// The default is 3.
+func ReconnectWithMaxAttempts(n int) ReconnectOption {
+	return ReconnectOption{func(ro *reconnectOptions) {
+		ro.maxAttempts = n
+	}}
+}
+
+// ReconnectWithBackoff returns a ReconnectOption that configures the delay
+// before the first retry. The delay doubles for each retry, up to max.
+// The default is 1 second, up to 30 seconds.
+func ReconnectWithBackoff(initial, max time.Duration) ReconnectOption {
+	return ReconnectOption{func(ro *reconnectOptions) {
+		ro.backoff = initial
+		ro.maxBackoff = max
+	}}
+}
+
+// ReconnectWithDialOptions returns a ReconnectOption that configures the
+// ReconnectingConn to open its connections with the given DialOptions.
+//
+// DialWithNetConn cannot be used as the connection could not be re-established.
+func ReconnectWithDialOptions(options ...DialOption) ReconnectOption {
+	return ReconnectOption{func(ro *reconnectOptions) {
+		ro.dialOptions = append(ro.dialOptions, options...)
+	}}
+}
+
+// DialReconnecting connects to the specified address and logs in with the
+// given credentials. The returned ReconnectingConn re-establishes the
+// connection when it breaks.
+func DialReconnecting(addr, user, password string, options ...ReconnectOption) (*ReconnectingConn, error) {
+	ro := &reconnectOptions{
+		maxAttempts: 3,
+		backoff:     time.Second,
+		maxBackoff:  30 * time.Second,
+	}
+	for _, option := range options {
+		option.setup(ro)
+	}
+
+	rc := &ReconnectingConn{
+		addr:     addr,
+		user:     user,
+		password: password,
+		options:  ro,
+	}
+
+	c, err := dialLogin(context.Background(), addr, user, password, ro.dialOptions)
+	if err != nil {
+		return nil, err
+	}
+	rc.c = c
+
+	return rc, nil
+}
+
+// Conn returns the current connection, after re-establishing it if it is
+// broken. It can be used for the operations that ReconnectingConn does not
+// provide, which are not retried.
+func (rc *ReconnectingConn) Conn() (*ServerConn, error) {
+	if rc.c != nil && !rc.c.isBroken() {
+		return rc.c, nil
+	}
+
+	return rc.reconnect()
+}
+
+// reconnect replaces the current connection with a new one and restores
+// the state of the session.
+func (rc *ReconnectingConn) reconnect() (*ServerConn, error) {
+	old := rc.c
+	if old != nil {
+		_ = old.Quit()
+		rc.c = nil
+	}
+
+	c, err := dialLogin(context.Background(), rc.addr, rc.user, rc.password, rc.options.dialOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	// Do not probe again what already failed with the previous connection
+	if old != nil {
+		c.skipEPSV = old.skipEPSV
+		c.skipEPRT = old.skipEPRT
+	}
+
+	if rc.dir != "" {
+		if err = c.ChangeDir(rc.dir); err != nil {
+			_ = c.Quit()
+			return nil, err
+		}
+	}
+
+	rc.c = c
+	return c, nil
+}
+
+// retry runs op until it succeeds, fails without breaking the connection,
+// or the maximum number of attempts is reached.
+func (rc *ReconnectingConn) retry(op func(c *ServerConn) error) error {
+	backoff := rc.options.backoff
+
+	for attempt := 1; ; attempt++ {
+		c, err := rc.Conn()
+		if err == nil {
+			err = op(c)
+			if err == nil || !c.isBroken() {
+				return err
+			}
+		}
+
+		if attempt >= rc.options.maxAttempts {
+			return err
+		}
+
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > rc.options.maxBackoff {
+			backoff = rc.options.maxBackoff
+		}
+	}
+}
+
+// List issues a LIST or MLSD FTP command, see ServerConn.List.
+func (rc *ReconnectingConn) List(path string) (entries []*Entry, err error) {
+	err = rc.retry(func(c *ServerConn) error {
+		entries, err = c.List(path)
+		return err
+	})
+	return entries, err
+}
+
+// NameList issues an NLST FTP command, see ServerConn.NameList.
+func (rc *ReconnectingConn) NameList(path string) (entries []string, err error) {
+	err = rc.retry(func(c *ServerConn) error {
+		entries, err = c.NameList(path)
+		return err
+	})
+	return entries, err
+}
+
+// FileSize issues a SIZE FTP command, see ServerConn.FileSize.
+func (rc *ReconnectingConn) FileSize(path string) (size int64, err error) {
+	err = rc.retry(func(c *ServerConn) error {
+		size, err = c.FileSize(path)
+		return err
+	})
+	return size, err
+}
+
+// CurrentDir issues a PWD FTP command, see ServerConn.CurrentDir.
+func (rc *ReconnectingConn) CurrentDir() (dir string, err error) {
+	err = rc.retry(func(c *ServerConn) error {
+		dir, err = c.CurrentDir()
+		return err
+	})
+	return dir, err
+}
+
+// ChangeDir issues a CWD FTP command, see ServerConn.ChangeDir.
+// The new current directory is restored after reconnecting.
+func (rc *ReconnectingConn) ChangeDir(path string) error {
+	return rc.retry(func(c *ServerConn) error {
+		return rc.changeDir(c, path)
+	})
+}
+
+// ChangeDirToParent issues a CDUP FTP command, see ServerConn.ChangeDirToParent.
+// The new current directory is restored after reconnecting.
+func (rc *ReconnectingConn) ChangeDirToParent() error {
+	// CDUP is not idempotent, so its retries use the absolute path
+	var parent string
+	return rc.retry(func(c *ServerConn) error {
+		if parent != "" {
+			return rc.changeDir(c, parent)
+		}
+
+		dir, err := c.CurrentDir()
+		if err != nil {
+			return err
+		}
+		parent = dir + "/.."
+		return rc.changeDir(c, parent)
+	})
+}
+
+// changeDir changes the current directory and records it
+func (rc *ReconnectingConn) changeDir(c *ServerConn, path string) error {
+	if err := c.ChangeDir(path); err != nil {
+		return err
+	}
+
+	dir, err := c.CurrentDir()
+	if err != nil {
+		return err
+	}
+	rc.dir = dir
+
+	return nil
+}
+
+// Retr issues a RETR FTP command, see ServerConn.Retr.
+//
+// When the connection breaks during the transfer, the returned ReadCloser
+// reconnects and resumes the transfer with REST where it stopped.
+func (rc *ReconnectingConn) Retr(path string) (io.ReadCloser, error) {
+	return rc.RetrFrom(path, 0)
+}
+
+// RetrFrom issues a RETR FTP command starting at the given offset, see
+// ServerConn.RetrFrom and Retr.
+func (rc *ReconnectingConn) RetrFrom(path string, offset uint64) (io.ReadCloser, error) {
+	r := &resumingResponse{rc: rc, path: path, offset: offset}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// NoOp issues a NOOP FTP command, see ServerConn.NoOp.
+func (rc *ReconnectingConn) NoOp() error {
+	return rc.retry(func(c *ServerConn) error {
+		return c.NoOp()
+	})
+}
+
+// Quit closes the current connection, see ServerConn.Quit.
+func (rc *ReconnectingConn) Quit() error {
+	if rc.c == nil {
+		return nil
+	}
+
+	err := rc.c.Quit()
+	rc.c = nil
+	return err
+}
+
+// resumingResponse is the data connection of a RETR transfer which is
+// resumed after reconnecting
+type resumingResponse struct {
+	rc     *ReconnectingConn
+	path   string
+	offset uint64
+	r      *Response
+	c      *ServerConn // connection of r
+	done   bool        // the transfer completed
+}
+
+// open starts the transfer at the current offset
+func (r *resumingResponse) open() error {
+	return r.rc.retry(func(c *ServerConn) error {
+		resp, err := c.RetrFrom(r.path, r.offset)
+		if err != nil {
+			return err
+		}
+		r.r, r.c = resp, c
+		return nil
+	})
+}
+
+func (r *resumingResponse) Read(buf []byte) (int, error) {
+	if r.done {
+		return 0, io.EOF
+	}
+
+	for attempt := 1; ; attempt++ {
+		if r.r == nil {
+			if err := r.open(); err != nil {
+				return 0, err
+			}
+		}
+
+		n, err := r.r.Read(buf)
+		r.offset += uint64(n)
+		if err == nil {
+			return n, nil
+		}
+
+		// The transfer completed: the final reply tells whether the
+		// control connection broke in the meantime
+		if err == io.EOF {
+			err = r.r.Close()
+			if err == nil {
+				r.r, r.done = nil, true
+				return n, io.EOF
+			}
+			if !r.c.isBroken() {
+				return n, err
+			}
+		} else {
+			_ = r.r.Abort()
+		}
+		r.r = nil
+
+		if n > 0 {
+			return n, nil
+		}
+		if attempt >= r.rc.options.maxAttempts {
+			return 0, err
+		}
+	}
+}
+
+func (r *resumingResponse) Close() error {
+	if r.r == nil {
+		return nil
+	}
+
+	err := r.r.Close()
+	r.r = nil
+	return err
+}
@@ -0,0 +1,104 @@
+package ftp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockDialer serves each control connection to poolAddr with a new mock server
+type mockDialer struct {
+	t     *testing.T
+	data  []byte // content of the files, testData if nil
+	mu    sync.Mutex
+	mocks []*ftpMock
+}
+
+func (d *mockDialer) dial(network, address string) (net.Conn, error) {
+	if address != poolAddr {
+		return net.Dial(network, address)
+	}
+
+	mock, err := newFtpMock(d.t, "127.0.0.1")
+	if err != nil {
+		return nil, err
+	}
+	mock.fileCont = bytes.NewBufferString(testData)
+	if d.data != nil {
+		mock.fileCont = bytes.NewBuffer(d.data)
+	}
+
+	d.mu.Lock()
+	d.mocks = append(d.mocks, mock)
+	d.mu.Unlock()
+
+	return net.Dial(network, mock.Addr())
+}
+
+func (d *mockDialer) count() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.mocks)
+}
+
+func dialTestReconnecting(t *testing.T) (*mockDialer, *ReconnectingConn) {
+	d := &mockDialer{t: t}
+	rc, err := DialReconnecting(poolAddr, "anonymous", "anonymous",
+		ReconnectWithBackoff(time.Millisecond, time.Millisecond),
+		ReconnectWithDialOptions(DialWithTimeout(5*time.Second), DialWithDialFunc(d.dial)),
+	)
+	require.NoError(t, err)
+	return d, rc
+}
+
+func TestReconnectRestoresSession(t *testing.T) {
+	d, rc := dialTestReconnecting(t)
+
+	require.NoError(t, rc.ChangeDir("incoming"))
+
+	// drop the TCP session
+	require.NoError(t, rc.c.netConn.Close())
+
+	size, err := rc.FileSize("magic-file")
+	require.NoError(t, err)
+	assert.Equal(t, int64(42), size)
+	assert.Equal(t, 2, d.count())
+
+	require.NoError(t, rc.Quit())
+	d.mocks[1].Wait()
+	assert.Equal(t, []string{"USER", "PASS", "FEAT", "TYPE", "OPTS", "CWD", "SIZE", "QUIT"}, d.mocks[1].commands)
+}
+
+func TestReconnectDoesNotRetryServerErrors(t *testing.T) {
+	d, rc := dialTestReconnecting(t)
+
+	_, err := rc.FileSize("not-found")
+	assert.Error(t, err)
+	assert.Equal(t, 1, d.count())
+
+	require.NoError(t, rc.Quit())
+}
+
+func TestReconnectRetr(t *testing.T) {
+	d, rc := dialTestReconnecting(t)
+
+	// drop the TCP session
+	require.NoError(t, rc.c.netConn.Close())
+
+	r, err := rc.Retr("file")
+	require.NoError(t, err)
+
+	buf, err := ioutil.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, testData, string(buf))
+	assert.NoError(t, r.Close())
+	assert.Equal(t, 2, d.count())
+
+	require.NoError(t, rc.Quit())
+}
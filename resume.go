@@ -0,0 +1,336 @@
+package ftp
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// checkpointSuffix is appended to the local path to name the checkpoint file
+const checkpointSuffix = ".ftp-checkpoint"
+
+// ResumeCheck is a set of checks made before resuming a transfer, see
+// TransferWithChecks. When a check fails, the transfer restarts from the
+// beginning.
+type ResumeCheck int
+
+// The checks made before resuming a transfer
+const (
+	// CheckSize checks that the size of the source did not change since
+	// the checkpoint was written.
+	CheckSize ResumeCheck = 1 << iota
+	// CheckModTime checks that the modification time of the source did not
+	// change since the checkpoint was written.
+	CheckModTime
+	// CheckHash checks that the data already transferred is identical on
+	// both sides, with HashRange.
+	CheckHash
+)
+
+// TransferOption represents an option of DownloadFile and UploadFile
+type TransferOption struct {
+	setup func(to *transferOptions)
+}
+
+// transferOptions contains all the options set by TransferOption.setup
+type transferOptions struct {
+	checkpoint bool
+	checks     ResumeCheck
+	hashAlgo   HashAlgo
+}
+
+// TransferWithCheckpoint returns a TransferOption that configures whether a
+// checkpoint file is written next to the local file during the transfer, so
+// that the checks can be made after a restart of the process. When enabled,
+// a transfer without a checkpoint restarts from the beginning, unless
+// CheckHash is set. When disabled, the destination is resumed as is if
+// CheckHash is not set.
+// The default is true.
+func TransferWithCheckpoint(enabled bool) TransferOption {
+	return TransferOption{func(to *transferOptions) {
+		to.checkpoint = enabled
+	}}
+}
+
+// TransferWithChecks returns a TransferOption that configures the checks
+// made before resuming a transfer. CheckSize and CheckModTime require a
+// checkpoint. With CheckHash, an error matching ErrNotSupported is returned
+// if the server cannot hash a range of the file.
+// The default is CheckSize|CheckModTime.
+func TransferWithChecks(checks ResumeCheck) TransferOption {
+	return TransferOption{func(to *transferOptions) {
+		to.checks = checks
+	}}
+}
+
+// TransferWithHashAlgo returns a TransferOption that configures the algorithm
+// used by CheckHash. The default is SHA-256.
+func TransferWithHashAlgo(algo HashAlgo) TransferOption {
+	return TransferOption{func(to *transferOptions) {
+		to.hashAlgo = algo
+	}}
+}
+
+func newTransferOptions(options []TransferOption) *transferOptions {
+	to := &transferOptions{
+		checkpoint: true,
+		checks:     CheckSize | CheckModTime,
+		hashAlgo:   HashSHA256,
+	}
+	for _, option := range options {
+		option.setup(to)
+	}
+	return to
+}
+
+// checkpoint describes the source of a transfer in progress. It is stored
+// in JSON next to the local file.
+type checkpoint struct {
+	Remote  string    `json:"remote"`
+	Upload  bool      `json:"upload"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// loadCheckpoint reads the checkpoint of the local file, nil if there is
+// none or it is unreadable
+func loadCheckpoint(local string) *checkpoint {
+	data, err := ioutil.ReadFile(local + checkpointSuffix)
+	if err != nil {
+		return nil
+	}
+
+	cp := &checkpoint{}
+	if err = json.Unmarshal(data, cp); err != nil {
+		return nil
+	}
+	return cp
+}
+
+func (cp *checkpoint) save(local string) error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(local+checkpointSuffix, data, 0644)
+}
+
+// DownloadFile downloads the remote file to the local path. If the local
+// file holds the beginning of the remote file after an interrupted
+// DownloadFile, the transfer is resumed with RetrFrom. An existing local file
+// without a checkpoint is overwritten, see TransferWithCheckpoint.
+func (c *ServerConn) DownloadFile(remote, local string, options ...TransferOption) error {
+	return c.DownloadFileContext(context.Background(), remote, local, options...)
+}
+
+// DownloadFileContext is like DownloadFile but the transfer is interrupted
+// when ctx is done.
+func (c *ServerConn) DownloadFileContext(ctx context.Context, remote, local string, options ...TransferOption) error {
+	to := newTransferOptions(options)
+
+	size, err := c.FileSizeContext(ctx, remote)
+	if err != nil {
+		return err
+	}
+	// The modification time is not checked if the server does not support MDTM
+	var modTime time.Time
+	if c.mdtmSupported {
+		modTime, err = c.GetTimeContext(ctx, remote)
+		if err != nil && !errors.Is(err, ErrNotSupported) {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(local, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	src := &checkpoint{Remote: remote, Size: size, ModTime: modTime}
+	offset, err := c.resumeOffset(ctx, to, local, src, f, st.Size())
+	if err != nil {
+		return err
+	}
+
+	if to.checkpoint {
+		if err = src.save(local); err != nil {
+			return err
+		}
+	}
+
+	if err = f.Truncate(offset); err != nil {
+		return err
+	}
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	if offset < size {
+		r, err := c.RetrFromContext(ctx, remote, uint64(offset))
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(f, r); err != nil {
+			_ = r.Abort()
+			return err
+		}
+		if err = r.Close(); err != nil {
+			return err
+		}
+	}
+
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return removeCheckpoint(local)
+}
+
+// UploadFile uploads the local file to the remote path. If the remote file
+// holds the beginning of the local file after an interrupted UploadFile, the
+// transfer is resumed with StorFrom. An existing remote file without a
+// checkpoint is overwritten, see TransferWithCheckpoint.
+func (c *ServerConn) UploadFile(local, remote string, options ...TransferOption) error {
+	return c.UploadFileContext(context.Background(), local, remote, options...)
+}
+
+// UploadFileContext is like UploadFile but the transfer is interrupted
+// when ctx is done.
+func (c *ServerConn) UploadFileContext(ctx context.Context, local, remote string, options ...TransferOption) error {
+	to := newTransferOptions(options)
+
+	f, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	// The remote file does not exist yet on the first attempt
+	remoteSize, err := c.FileSizeContext(ctx, remote)
+	exists := err == nil
+	if errors.Is(err, ErrNotFound) {
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+
+	src := &checkpoint{Remote: remote, Upload: true, Size: st.Size(), ModTime: st.ModTime().UTC()}
+	offset, err := c.resumeOffset(ctx, to, local, src, f, remoteSize)
+	if err != nil {
+		return err
+	}
+
+	if to.checkpoint {
+		if err = src.save(local); err != nil {
+			return err
+		}
+	}
+
+	// A remote file larger than the local one is replaced too
+	if !exists || offset < st.Size() || remoteSize != st.Size() {
+		if _, err = f.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		if err = c.StorFromContext(ctx, remote, f, uint64(offset)); err != nil {
+			return err
+		}
+	}
+
+	return removeCheckpoint(local)
+}
+
+// resumeOffset returns the offset where the transfer from src resumes, given
+// the size of the partial destination. It is 0 if the checks fail.
+func (c *ServerConn) resumeOffset(ctx context.Context, to *transferOptions, local string, src *checkpoint, f *os.File, partial int64) (int64, error) {
+	if partial <= 0 || partial > src.Size {
+		return 0, nil
+	}
+
+	// Without a checkpoint, the destination may be an unrelated file. It is
+	// only trusted if the checkpoints are disabled or the hashes are checked.
+	cp := loadCheckpoint(local)
+	if cp == nil && to.checkpoint && to.checks&CheckHash == 0 {
+		return 0, nil
+	}
+	if cp != nil {
+		if cp.Remote != src.Remote || cp.Upload != src.Upload {
+			return 0, nil
+		}
+		if to.checks&CheckSize != 0 && cp.Size != src.Size {
+			return 0, nil
+		}
+		if to.checks&CheckModTime != 0 && !cp.ModTime.Equal(src.ModTime) {
+			return 0, nil
+		}
+	}
+
+	if to.checks&CheckHash != 0 {
+		remoteHash, err := c.HashRangeContext(ctx, src.Remote, to.hashAlgo, 0, partial)
+		if err != nil {
+			return 0, err
+		}
+		localHash, err := hashFile(f, to.hashAlgo, partial)
+		if err != nil {
+			return 0, err
+		}
+		if localHash != remoteHash {
+			return 0, nil
+		}
+	}
+
+	return partial, nil
+}
+
+// hashFile returns the hash of the n first bytes of the file, as a
+// lowercase hexadecimal string
+func hashFile(f *os.File, algo HashAlgo, n int64) (string, error) {
+	var h hash.Hash
+	switch algo {
+	case HashCRC32:
+		h = crc32.NewIEEE()
+	case HashMD5:
+		h = md5.New()
+	case HashSHA1:
+		h = sha1.New()
+	case HashSHA256:
+		h = sha256.New()
+	default:
+		h = sha512.New()
+	}
+
+	if _, err := io.Copy(h, io.NewSectionReader(f, 0, n)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// removeCheckpoint removes the checkpoint of the local file, if any
+func removeCheckpoint(local string) error {
+	err := os.Remove(local + checkpointSuffix)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
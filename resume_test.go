@@ -0,0 +1,208 @@
+package ftp
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testModTime is the modification time of data-file returned by the mock
+var testModTime = time.Date(2020, 12, 13, 20, 24, 0, 123000000, time.UTC)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "ftp")
+	require.NoError(t, err)
+	return dir
+}
+
+func TestDownloadFile(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	local := filepath.Join(dir, "data")
+
+	d, c := dialTestParallel(t, 64*1024)
+	require.NoError(t, c.DownloadFile("data-file", local))
+	require.NoError(t, c.Quit())
+	d.mocks[0].Wait()
+
+	// MDTM is not advertised by the mock
+	assert.NotContains(t, d.mocks[0].commands, "MDTM")
+
+	data, err := ioutil.ReadFile(local)
+	require.NoError(t, err)
+	assert.Equal(t, d.data, data)
+	assert.NoFileExists(t, local+checkpointSuffix)
+}
+
+func TestDownloadFileResume(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	local := filepath.Join(dir, "data")
+
+	d, c := dialTestParallel(t, 64*1024)
+	c.mdtmSupported = true
+
+	// an interrupted download
+	require.NoError(t, ioutil.WriteFile(local, d.data[:1000], 0644))
+	cp := &checkpoint{Remote: "data-file", Size: int64(len(d.data)), ModTime: testModTime}
+	require.NoError(t, cp.save(local))
+
+	require.NoError(t, c.DownloadFile("data-file", local))
+	require.NoError(t, c.Quit())
+	d.mocks[0].Wait()
+
+	data, err := ioutil.ReadFile(local)
+	require.NoError(t, err)
+	assert.Equal(t, d.data, data)
+	assert.NoFileExists(t, local+checkpointSuffix)
+	assert.Contains(t, d.mocks[0].commands, "REST")
+}
+
+func TestDownloadFileSourceChanged(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	local := filepath.Join(dir, "data")
+
+	d, c := dialTestParallel(t, 64*1024)
+	c.mdtmSupported = true
+
+	// the remote file was modified since the checkpoint
+	require.NoError(t, ioutil.WriteFile(local, make([]byte, 1000), 0644))
+	cp := &checkpoint{Remote: "data-file", Size: int64(len(d.data)), ModTime: testModTime.Add(-time.Hour)}
+	require.NoError(t, cp.save(local))
+
+	require.NoError(t, c.DownloadFile("data-file", local))
+	require.NoError(t, c.Quit())
+	d.mocks[0].Wait()
+
+	data, err := ioutil.ReadFile(local)
+	require.NoError(t, err)
+	assert.Equal(t, d.data, data)
+	assert.NotContains(t, d.mocks[0].commands, "REST")
+}
+
+func TestDownloadFileCheckHash(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	local := filepath.Join(dir, "data")
+
+	d, c := dialTestParallel(t, 64*1024)
+	c.features["HASH"] = "SHA-256*"
+	c.features["RANG"] = "STREAM"
+
+	// the partial file does not match the hash returned by the mock
+	require.NoError(t, ioutil.WriteFile(local, make([]byte, 1000), 0644))
+
+	require.NoError(t, c.DownloadFile("data-file", local, TransferWithChecks(CheckHash)))
+	require.NoError(t, c.Quit())
+	d.mocks[0].Wait()
+
+	data, err := ioutil.ReadFile(local)
+	require.NoError(t, err)
+	assert.Equal(t, d.data, data)
+	assert.Contains(t, d.mocks[0].commands, "HASH")
+	assert.NotContains(t, d.mocks[0].commands, "REST")
+}
+
+func TestUploadFileResume(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	local := filepath.Join(dir, "data")
+
+	content := make([]byte, 64*1024)
+	for i := range content {
+		content[i] = byte(i)
+	}
+	require.NoError(t, ioutil.WriteFile(local, content, 0644))
+	st, err := os.Stat(local)
+	require.NoError(t, err)
+
+	// an interrupted upload
+	d := &mockDialer{t: t, data: append([]byte(nil), content[:1000]...)}
+	c, err := dialLogin(context.Background(), poolAddr, "anonymous", "anonymous",
+		[]DialOption{DialWithTimeout(5 * time.Second), DialWithDialFunc(d.dial)})
+	require.NoError(t, err)
+	cp := &checkpoint{Remote: "data-file", Upload: true, Size: st.Size(), ModTime: st.ModTime().UTC()}
+	require.NoError(t, cp.save(local))
+
+	require.NoError(t, c.UploadFile(local, "data-file"))
+	require.NoError(t, c.Quit())
+	d.mocks[0].Wait()
+
+	assert.Equal(t, content, d.mocks[0].fileCont.Bytes())
+	assert.Contains(t, d.mocks[0].commands, "REST")
+	assert.NoFileExists(t, local+checkpointSuffix)
+}
+
+func TestDownloadFileUnrelated(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	local := filepath.Join(dir, "data")
+
+	d, c := dialTestParallel(t, 64*1024)
+
+	// an unrelated local file, smaller then of the same size
+	for _, old := range [][]byte{[]byte("OLD LOCAL CONTENT"), make([]byte, len(d.data))} {
+		require.NoError(t, ioutil.WriteFile(local, old, 0644))
+		require.NoError(t, c.DownloadFile("data-file", local))
+
+		data, err := ioutil.ReadFile(local)
+		require.NoError(t, err)
+		assert.Equal(t, d.data, data)
+	}
+
+	require.NoError(t, c.Quit())
+	d.mocks[0].Wait()
+	assert.NotContains(t, d.mocks[0].commands, "REST")
+}
+
+func TestUploadFileUnrelated(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	local := filepath.Join(dir, "data")
+
+	content := make([]byte, 64*1024)
+	for i := range content {
+		content[i] = byte(i)
+	}
+	require.NoError(t, ioutil.WriteFile(local, content, 0644))
+
+	// an unrelated remote file
+	d := &mockDialer{t: t, data: []byte("OLD REMOTE CONTENT")}
+	c, err := dialLogin(context.Background(), poolAddr, "anonymous", "anonymous",
+		[]DialOption{DialWithTimeout(5 * time.Second), DialWithDialFunc(d.dial)})
+	require.NoError(t, err)
+
+	require.NoError(t, c.UploadFile(local, "data-file"))
+	require.NoError(t, c.Quit())
+	d.mocks[0].Wait()
+
+	assert.Equal(t, content, d.mocks[0].fileCont.Bytes())
+	assert.NotContains(t, d.mocks[0].commands, "REST")
+}
+
+func TestUploadFileEmpty(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	local := filepath.Join(dir, "data")
+	require.NoError(t, ioutil.WriteFile(local, nil, 0644))
+
+	// the remote file is larger than the local one
+	d := &mockDialer{t: t, data: []byte("hello world")}
+	c, err := dialLogin(context.Background(), poolAddr, "anonymous", "anonymous",
+		[]DialOption{DialWithTimeout(5 * time.Second), DialWithDialFunc(d.dial)})
+	require.NoError(t, err)
+
+	require.NoError(t, c.UploadFile(local, "data-file"))
+	require.NoError(t, c.Quit())
+	d.mocks[0].Wait()
+
+	assert.Equal(t, 0, d.mocks[0].fileCont.Len())
+	assert.Contains(t, d.mocks[0].commands, "STOR")
+}
@@ -0,0 +1,103 @@
+package ftp
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSerializedCallsWaitForResponse(t *testing.T) {
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second), DialWithSerializedCalls(true))
+
+	r, err := c.Retr("big-file")
+	require.NoError(t, err)
+
+	done := make(chan int64, 1)
+	go func() {
+		size, err := c.FileSize("magic-file")
+		assert.NoError(t, err)
+		done <- size
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("FileSize did not wait for the Response to be closed")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	assert.NoError(t, r.Abort())
+	assert.Equal(t, int64(42), <-done)
+
+	closeConn(t, mock, c, []string{"EPSV", "RETR", "ABOR", "SIZE"})
+}
+
+func TestSerializedCallsConcurrent(t *testing.T) {
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second), DialWithSerializedCalls(true))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			size, err := c.FileSize("magic-file")
+			assert.NoError(t, err)
+			assert.Equal(t, int64(42), size)
+
+			dir, err := c.CurrentDir()
+			assert.NoError(t, err)
+			assert.Equal(t, "/incoming", dir)
+
+			_, err = c.List("")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	require.NoError(t, c.Quit())
+	mock.Wait()
+
+	// USER, PASS, FEAT, TYPE, OPTS, then SIZE, PWD, EPSV and LIST for each
+	// goroutine, and QUIT
+	assert.Len(t, mock.commands, 5+8*4+1)
+}
+
+func TestSerializedCallsContext(t *testing.T) {
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second), DialWithSerializedCalls(true))
+
+	r, err := c.Retr("big-file")
+	require.NoError(t, err)
+
+	// the context expires while waiting for the Response to be closed
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err = c.FileSizeContext(ctx, "magic-file")
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	assert.NoError(t, r.Abort())
+	assert.NoError(t, c.NoOp())
+
+	closeConn(t, mock, c, []string{"EPSV", "RETR", "ABOR", "NOOP"})
+}
+
+func TestConnBusy(t *testing.T) {
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second))
+
+	r, err := c.Retr("big-file")
+	require.NoError(t, err)
+
+	_, err = c.FileSize("magic-file")
+	assert.Equal(t, ErrConnBusy, err)
+
+	assert.NoError(t, r.Abort())
+
+	size, err := c.FileSize("magic-file")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), size)
+
+	closeConn(t, mock, c, []string{"EPSV", "RETR", "ABOR", "SIZE"})
+}
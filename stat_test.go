@@ -0,0 +1,69 @@
+package ftp
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatMLST(t *testing.T) {
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second))
+	c.mlstSupported = true
+
+	entry, err := c.Stat("magic-file")
+	require.NoError(t, err)
+	assert.Equal(t, "magic-file", entry.Name)
+	assert.Equal(t, EntryTypeFile, entry.Type)
+	assert.Equal(t, uint64(42), entry.Size)
+	assert.Equal(t, time.Date(2020, 12, 13, 20, 24, 0, 0, time.UTC), entry.Time)
+
+	_, err = c.Stat("missing-file")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	closeConn(t, mock, c, []string{"MLST", "MLST"})
+}
+
+func TestStatList(t *testing.T) {
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second))
+
+	entry, err := c.Stat("/incoming/lo")
+	require.NoError(t, err)
+	assert.Equal(t, "lo", entry.Name)
+	assert.Equal(t, EntryTypeFile, entry.Type)
+	assert.Equal(t, "LIST /incoming/", mock.lastFull)
+
+	entry, err = c.Stat("lo")
+	require.NoError(t, err)
+	assert.Equal(t, "lo", entry.Name)
+	assert.Equal(t, "LIST", mock.lastFull)
+
+	_, err = c.Stat("missing-file")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	entry, err = c.Stat("/")
+	require.NoError(t, err)
+	assert.Equal(t, EntryTypeFolder, entry.Type)
+
+	closeConn(t, mock, c, []string{"EPSV", "LIST", "EPSV", "LIST", "EPSV", "LIST"})
+}
+
+func TestSplitPath(t *testing.T) {
+	tests := []struct {
+		path, dir, name string
+	}{
+		{"file", "", "file"},
+		{"dir/file", "dir/", "file"},
+		{"/dir/sub/", "/dir/", "sub"},
+		{"/file", "/", "file"},
+		{"/", "/", ""},
+	}
+
+	for _, test := range tests {
+		dir, name := splitPath(test.path)
+		assert.Equal(t, test.dir, dir, test.path)
+		assert.Equal(t, test.name, name, test.path)
+	}
+}
@@ -0,0 +1,63 @@
+package ftp
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetTime(t *testing.T) {
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second))
+
+	tm, err := c.GetTime("magic-file")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2020, 12, 13, 20, 24, 0, 123000000, time.UTC), tm)
+
+	_, err = c.GetTime("missing-file")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	closeConn(t, mock, c, []string{"MDTM", "MDTM"})
+}
+
+func TestSetTime(t *testing.T) {
+	tm := time.Date(2020, 12, 13, 21, 24, 0, 0, time.FixedZone("CET", 3600))
+
+	// neither MFMT nor MDTM
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second))
+	assert.True(t, errors.Is(c.SetTime("magic-file", tm), ErrNotSupported))
+	closeConn(t, mock, c, nil)
+
+	mock, c = openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second))
+	c.mfmtSupported = true
+	assert.NoError(t, c.SetTime("magic-file", tm))
+	assert.Equal(t, "MFMT 20201213202400 magic-file", mock.lastFull)
+	closeConn(t, mock, c, []string{"MFMT"})
+
+	// MDTM is only used to set the time when enabled
+	mock, c = openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second), DialWithWritingMDTM(true))
+	c.mdtmSupported = true
+	assert.NoError(t, c.SetTime("magic-file", tm))
+	assert.Equal(t, "MDTM 20201213202400 magic-file", mock.lastFull)
+	closeConn(t, mock, c, []string{"MDTM"})
+}
+
+func TestSetFacts(t *testing.T) {
+	tm := time.Date(2020, 12, 13, 20, 24, 0, 0, time.UTC)
+
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second))
+	err := c.SetFacts("magic-file", Facts{ModTime: tm})
+	assert.True(t, errors.Is(err, ErrNotSupported))
+
+	c.features["MFF"] = "modify;unix.mode;"
+	err = c.SetFacts("magic-file", Facts{ModTime: tm, Mode: 0640})
+	assert.NoError(t, err)
+	assert.Equal(t, "MFF modify=20201213202400;unix.mode=0640; magic-file", mock.lastFull)
+
+	err = c.SetFacts("magic-file", Facts{CreateTime: tm})
+	assert.True(t, errors.Is(err, ErrNotSupported))
+
+	closeConn(t, mock, c, []string{"MFF"})
+}
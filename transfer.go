@@ -0,0 +1,158 @@
+package ftp
+
+import (
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TransferInfo describes the progress of a transfer over a data connection,
+// see DialWithTransferObserver
+type TransferInfo struct {
+	Command string        // RETR, STOR, STOU, APPE, LIST, MLSD or NLST
+	Path    string        // argument of the command, if any
+	Offset  int64         // offset where the transfer started, see RetrFrom and StorFrom
+	Size    int64         // size of the file once transferred, -1 if unknown
+	Bytes   int64         // bytes transferred so far
+	Elapsed time.Duration // time elapsed since the start of the transfer
+	Done    bool          // the transfer is over
+	Err     error         // error which ended the transfer, if any
+}
+
+// Rate returns the average throughput of the transfer, in bytes per second
+func (ti TransferInfo) Rate() float64 {
+	if ti.Elapsed <= 0 {
+		return 0
+	}
+	return float64(ti.Bytes) / ti.Elapsed.Seconds()
+}
+
+// observedConn is a data connection reporting its progress to an observer
+type observedConn struct {
+	net.Conn
+	observer func(TransferInfo)
+	start    time.Time
+
+	mu   sync.Mutex // protects info
+	info TransferInfo
+}
+
+// newObservedConn wraps the data connection opened for the command line.
+// The size of the file is read from the preliminary reply, such as
+// "150 Opening BINARY mode data connection for file (1234 bytes)".
+func newObservedConn(conn net.Conn, observer func(TransferInfo), line string, offset uint64, msg string) *observedConn {
+	cmd := parseCommand(line)
+	return &observedConn{
+		Conn:     conn,
+		observer: observer,
+		start:    time.Now(),
+		info: TransferInfo{
+			Command: cmd.name,
+			Path:    cmd.path,
+			Offset:  int64(offset),
+			Size:    parseTransferSize(msg),
+		},
+	}
+}
+
+// parseTransferSize returns the size announced by a preliminary reply, or
+// -1 if there is none
+func parseTransferSize(msg string) int64 {
+	i := strings.LastIndexByte(msg, '(')
+	if i < 0 || !strings.HasSuffix(msg, " bytes)") {
+		return -1
+	}
+
+	size, err := strconv.ParseInt(msg[i+1:len(msg)-len(" bytes)")], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return size
+}
+
+func (oc *observedConn) Read(buf []byte) (int, error) {
+	n, err := oc.Conn.Read(buf)
+	oc.report(n, false, nil)
+	return n, err
+}
+
+func (oc *observedConn) Write(buf []byte) (int, error) {
+	n, err := oc.Conn.Write(buf)
+	oc.report(n, false, nil)
+	return n, err
+}
+
+// Handshake starts the TLS handshake of the data connection, if any, see
+// storFrom
+func (oc *observedConn) Handshake() error {
+	if tlsConn, ok := oc.Conn.(interface{ Handshake() error }); ok {
+		return tlsConn.Handshake()
+	}
+	return nil
+}
+
+// report calls the observer after n bytes were transferred, or when the
+// transfer is over. Nothing is reported after the end of the transfer.
+func (oc *observedConn) report(n int, done bool, err error) {
+	if n <= 0 && !done {
+		return
+	}
+
+	oc.mu.Lock()
+	if oc.info.Done {
+		oc.mu.Unlock()
+		return
+	}
+	oc.info.Bytes += int64(n)
+	oc.info.Elapsed = time.Since(oc.start)
+	oc.info.Done = done
+	oc.info.Err = err
+	info := oc.info
+	oc.mu.Unlock()
+
+	oc.observer(info)
+}
+
+// endTransfer reports the end of the transfer over the data connection,
+// if it is observed
+func endTransfer(conn net.Conn, err error) {
+	if oc, ok := conn.(*observedConn); ok {
+		oc.report(0, true, err)
+	}
+}
+
+// setTransferSize sets the size of an observed upload, when the size of its
+// source is known
+func setTransferSize(conn net.Conn, r io.Reader) {
+	oc, ok := conn.(*observedConn)
+	if !ok {
+		return
+	}
+
+	var size int64 = -1
+	switch r := r.(type) {
+	case interface{ Len() int }:
+		size = int64(r.Len())
+	case *os.File:
+		st, err := r.Stat()
+		if err != nil {
+			return
+		}
+		pos, err := r.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return
+		}
+		size = st.Size() - pos
+	}
+	if size < 0 {
+		return
+	}
+
+	oc.mu.Lock()
+	oc.info.Size = oc.info.Offset + size
+	oc.mu.Unlock()
+}
@@ -0,0 +1,108 @@
+package ftp
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// transferRecorder records the TransferInfo reported by a ServerConn
+type transferRecorder struct {
+	mu    sync.Mutex
+	infos []TransferInfo
+}
+
+func (tr *transferRecorder) observe(info TransferInfo) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.infos = append(tr.infos, info)
+}
+
+// last returns the last TransferInfo reported and checks that the previous
+// ones were not final
+func (tr *transferRecorder) last(t *testing.T) TransferInfo {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+
+	require.NotEmpty(t, tr.infos)
+	for _, info := range tr.infos[:len(tr.infos)-1] {
+		assert.False(t, info.Done)
+	}
+	info := tr.infos[len(tr.infos)-1]
+	tr.infos = nil
+	return info
+}
+
+func TestTransferObserver(t *testing.T) {
+	tr := &transferRecorder{}
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second), DialWithTransferObserver(tr.observe))
+
+	err := c.Stor("test", bytes.NewBufferString(testData))
+	require.NoError(t, err)
+	info := tr.last(t)
+	assert.Equal(t, "STOR", info.Command)
+	assert.Equal(t, "test", info.Path)
+	assert.Equal(t, int64(len(testData)), info.Size)
+	assert.Equal(t, int64(len(testData)), info.Bytes)
+	assert.True(t, info.Done)
+	assert.NoError(t, info.Err)
+
+	r, err := c.Retr("test")
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	info = tr.last(t)
+	assert.Equal(t, "RETR", info.Command)
+	assert.Equal(t, int64(len(testData)), info.Size)
+	assert.Equal(t, int64(len(testData)), info.Bytes)
+	assert.True(t, info.Done)
+	assert.NoError(t, info.Err)
+
+	_, err = c.List("/")
+	require.NoError(t, err)
+	info = tr.last(t)
+	assert.Equal(t, "LIST", info.Command)
+	assert.Equal(t, int64(-1), info.Size)
+	assert.True(t, info.Bytes > 0)
+	assert.True(t, info.Done)
+
+	closeConn(t, mock, c, []string{"EPSV", "STOR", "EPSV", "RETR", "EPSV", "LIST"})
+}
+
+func TestTransferObserverAbort(t *testing.T) {
+	tr := &transferRecorder{}
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second), DialWithTransferObserver(tr.observe))
+
+	r, err := c.Retr("big-file")
+	require.NoError(t, err)
+	_, err = io.ReadFull(r, make([]byte, 10))
+	require.NoError(t, err)
+	require.NoError(t, r.Abort())
+
+	info := tr.last(t)
+	assert.Equal(t, int64(-1), info.Size)
+	assert.True(t, info.Bytes >= 10)
+	assert.True(t, info.Done)
+	assert.Equal(t, ErrTransferAborted, info.Err)
+
+	closeConn(t, mock, c, []string{"EPSV", "RETR", "ABOR"})
+}
+
+func TestParseTransferSize(t *testing.T) {
+	assert.Equal(t, int64(1234), parseTransferSize("Opening BINARY mode data connection for file (1234 bytes)"))
+	assert.Equal(t, int64(-1), parseTransferSize("Opening BINARY mode data connection for file"))
+	assert.Equal(t, int64(-1), parseTransferSize("Opening data connection (x bytes)"))
+}
+
+func TestTransferInfoRate(t *testing.T) {
+	info := TransferInfo{Bytes: 3000, Elapsed: 2 * time.Second}
+	assert.Equal(t, 1500.0, info.Rate())
+	assert.Equal(t, 0.0, TransferInfo{}.Rate())
+}
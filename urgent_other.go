@@ -0,0 +1,15 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris
+
+package ftp
+
+import (
+	"errors"
+	"net"
+)
+
+// sendUrgent is not supported on this platform, ABOR is sent without the
+// Telnet signals.
+func sendUrgent(conn *net.TCPConn, b []byte) error {
+	return errors.New("urgent data is not supported")
+}
@@ -0,0 +1,265 @@
+package ftp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// WritableFS is a small writable file system, so that the code writing files
+// can use an FTP server, see ServerConn.WritableFS, or a local directory, see
+// DirWritableFS, interchangeably.
+//
+// The names are slash-separated paths relative to the root of the file
+// system, without "." or ".." elements. The errors are those of the os
+// package, such as *os.PathError, and match os.ErrNotExist and
+// os.ErrPermission when relevant.
+type WritableFS interface {
+	// Create creates or truncates the named file.
+	Create(name string) (io.WriteCloser, error)
+	// OpenFile opens the named file for writing. The flags os.O_APPEND,
+	// os.O_CREATE, os.O_EXCL and os.O_TRUNC are supported. Without
+	// os.O_APPEND, the file is truncated.
+	OpenFile(name string, flag int) (io.WriteCloser, error)
+	// MkdirAll creates the named directory and its missing parents.
+	MkdirAll(name string) error
+	// RemoveAll removes the named file or directory and its content. It
+	// returns nil if the file does not exist.
+	RemoveAll(name string) error
+	// Rename renames the file oldname to newname.
+	Rename(oldname, newname string) error
+	// Chtimes changes the access and modification times of the named file.
+	// The access time is ignored by the FTP implementation.
+	Chtimes(name string, atime, mtime time.Time) error
+}
+
+// validName reports whether the name is valid for a WritableFS
+func validName(name string) bool {
+	if name == "." {
+		return true
+	}
+	if name == "" || strings.HasPrefix(name, "/") || strings.ContainsRune(name, '\\') {
+		return false
+	}
+	for _, elem := range strings.Split(name, "/") {
+		if elem == "" || elem == "." || elem == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// writableFS implements WritableFS on an FTP server
+type writableFS struct {
+	c    *ServerConn
+	root string
+}
+
+// WritableFS returns a WritableFS of the remote files under the root
+// directory, which must exist. Unlike RemoveDirRecur, it does not change the
+// current directory.
+func (c *ServerConn) WritableFS(root string) WritableFS {
+	return &writableFS{c: c, root: root}
+}
+
+// remotePath returns the path on the server of the named file
+func (wfs *writableFS) remotePath(op, name string) (string, error) {
+	if !validName(name) {
+		return "", &os.PathError{Op: op, Path: name, Err: os.ErrInvalid}
+	}
+	if wfs.root == "" {
+		return name, nil
+	}
+	return path.Join(wfs.root, name), nil
+}
+
+func (wfs *writableFS) Create(name string) (io.WriteCloser, error) {
+	return wfs.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+}
+
+func (wfs *writableFS) OpenFile(name string, flag int) (io.WriteCloser, error) {
+	p, err := wfs.remotePath("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	// The existence of the file is only checked if the flags require it
+	if flag&os.O_EXCL != 0 || flag&os.O_CREATE == 0 {
+		_, err = wfs.c.Stat(p)
+		switch {
+		case err == nil && flag&os.O_EXCL != 0 && flag&os.O_CREATE != 0:
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrExist}
+		case err != nil && (flag&os.O_CREATE == 0 || !errors.Is(err, ErrNotFound)):
+			return nil, pathError("open", name, err)
+		}
+	}
+
+	var w io.WriteCloser
+	if flag&os.O_APPEND != 0 {
+		w, err = wfs.c.AppendWriter(p)
+	} else {
+		w, err = wfs.c.StorWriter(p)
+	}
+	if err != nil {
+		return nil, pathError("open", name, err)
+	}
+	return w, nil
+}
+
+// MkdirAll creates the directories one path element at a time. When MakeDir
+// fails, the directory may already exist, which is checked with Stat.
+func (wfs *writableFS) MkdirAll(name string) error {
+	if _, err := wfs.remotePath("mkdir", name); err != nil || name == "." {
+		return err
+	}
+
+	dir := wfs.root
+	for _, elem := range strings.Split(name, "/") {
+		dir = path.Join(dir, elem)
+		err := wfs.c.MakeDir(dir)
+		if err == nil {
+			continue
+		}
+
+		entry, errStat := wfs.c.Stat(dir)
+		if errStat != nil {
+			return pathError("mkdir", name, err)
+		}
+		if entry.Type != EntryTypeFolder {
+			return &os.PathError{Op: "mkdir", Path: name, Err: fmt.Errorf("%s is not a directory", dir)}
+		}
+	}
+	return nil
+}
+
+func (wfs *writableFS) RemoveAll(name string) error {
+	p, err := wfs.remotePath("removeall", name)
+	if err != nil {
+		return err
+	}
+	if name == "." {
+		return &os.PathError{Op: "removeall", Path: name, Err: os.ErrInvalid}
+	}
+
+	entry, err := wfs.c.Stat(p)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err == nil {
+		err = wfs.c.removeAll(p, entry)
+	}
+	if err != nil {
+		return pathError("removeall", name, err)
+	}
+	return nil
+}
+
+func (wfs *writableFS) Rename(oldname, newname string) error {
+	from, err := wfs.remotePath("rename", oldname)
+	if err != nil {
+		return err
+	}
+	to, err := wfs.remotePath("rename", newname)
+	if err != nil {
+		return err
+	}
+
+	if err = wfs.c.Rename(from, to); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldname, New: newname, Err: &mappedError{err}}
+	}
+	return nil
+}
+
+func (wfs *writableFS) Chtimes(name string, atime, mtime time.Time) error {
+	p, err := wfs.remotePath("chtimes", name)
+	if err != nil {
+		return err
+	}
+
+	if err = wfs.c.SetTime(p, mtime); err != nil {
+		return pathError("chtimes", name, err)
+	}
+	return nil
+}
+
+// dirWritableFS implements WritableFS on a local directory
+type dirWritableFS string
+
+// DirWritableFS returns a WritableFS of the files under the local directory,
+// which behaves like the WritableFS of a ServerConn.
+func DirWritableFS(dir string) WritableFS {
+	return dirWritableFS(dir)
+}
+
+// localPath returns the path of the named file
+func (dir dirWritableFS) localPath(op, name string) (string, error) {
+	if !validName(name) {
+		return "", &os.PathError{Op: op, Path: name, Err: os.ErrInvalid}
+	}
+	return filepath.Join(string(dir), filepath.FromSlash(name)), nil
+}
+
+func (dir dirWritableFS) Create(name string) (io.WriteCloser, error) {
+	return dir.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+}
+
+func (dir dirWritableFS) OpenFile(name string, flag int) (io.WriteCloser, error) {
+	p, err := dir.localPath("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	flag &= os.O_APPEND | os.O_CREATE | os.O_EXCL | os.O_TRUNC
+	if flag&os.O_APPEND == 0 {
+		flag |= os.O_TRUNC
+	}
+	f, err := os.OpenFile(p, flag|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (dir dirWritableFS) MkdirAll(name string) error {
+	p, err := dir.localPath("mkdir", name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(p, 0755)
+}
+
+func (dir dirWritableFS) RemoveAll(name string) error {
+	p, err := dir.localPath("removeall", name)
+	if err != nil {
+		return err
+	}
+	if name == "." {
+		return &os.PathError{Op: "removeall", Path: name, Err: os.ErrInvalid}
+	}
+	return os.RemoveAll(p)
+}
+
+func (dir dirWritableFS) Rename(oldname, newname string) error {
+	from, err := dir.localPath("rename", oldname)
+	if err != nil {
+		return err
+	}
+	to, err := dir.localPath("rename", newname)
+	if err != nil {
+		return err
+	}
+	return os.Rename(from, to)
+}
+
+func (dir dirWritableFS) Chtimes(name string, atime, mtime time.Time) error {
+	p, err := dir.localPath("chtimes", name)
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(p, atime, mtime)
+}
@@ -0,0 +1,132 @@
+package ftp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWritableFS(t *testing.T) {
+	debug := &bytes.Buffer{}
+	d := &mockDialer{t: t}
+	c, err := dialLogin(context.Background(), poolAddr, "anonymous", "anonymous",
+		[]DialOption{DialWithTimeout(5 * time.Second), DialWithDialFunc(d.dial), DialWithDebugOutput(debug)})
+	require.NoError(t, err)
+	c.mfmtSupported = true
+	wfs := c.WritableFS("/mirror")
+
+	w, err := wfs.Create("new-file")
+	require.NoError(t, err)
+	_, err = io.WriteString(w, "hello")
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	w, err = wfs.OpenFile("new-file", os.O_WRONLY|os.O_CREATE|os.O_APPEND)
+	require.NoError(t, err)
+	_, err = io.WriteString(w, " world")
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	_, err = wfs.OpenFile("file", os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	assert.True(t, errors.Is(err, os.ErrExist))
+	_, err = wfs.OpenFile("missing", os.O_WRONLY)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	// dir already exists
+	require.NoError(t, wfs.MkdirAll("dir/a/b"))
+	require.NoError(t, wfs.RemoveAll("dir"))
+	require.NoError(t, wfs.RemoveAll("missing"))
+	require.NoError(t, wfs.Rename("file", "renamed"))
+	require.NoError(t, wfs.Chtimes("renamed", mirrorTime, mirrorTime))
+
+	_, err = wfs.Create("../escape")
+	assert.True(t, errors.Is(err, os.ErrInvalid))
+
+	require.NoError(t, c.Quit())
+	d.mocks[0].Wait()
+	assert.Equal(t, "hello world", d.mocks[0].fileCont.String())
+
+	for _, line := range []string{
+		"STOR /mirror/new-file",
+		"APPE /mirror/new-file",
+		"MKD /mirror/dir",
+		"MKD /mirror/dir/a",
+		"MKD /mirror/dir/a/b",
+		"DELE /mirror/dir/sub-file",
+		"RMD /mirror/dir",
+		"RNFR /mirror/file",
+		"RNTO /mirror/renamed",
+		"MFMT 20200129000000 /mirror/renamed",
+	} {
+		assert.Contains(t, debug.String(), line+"\r\n")
+	}
+	assert.NotContains(t, debug.String(), "CWD")
+}
+
+func TestDirWritableFS(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	wfs := DirWritableFS(dir)
+
+	w, err := wfs.Create("file")
+	require.NoError(t, err)
+	_, err = io.WriteString(w, "hello")
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	w, err = wfs.OpenFile("file", os.O_WRONLY|os.O_APPEND)
+	require.NoError(t, err)
+	_, err = io.WriteString(w, " world")
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "file"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+
+	_, err = wfs.OpenFile("file", os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	assert.True(t, errors.Is(err, os.ErrExist))
+	_, err = wfs.OpenFile("missing", os.O_WRONLY)
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+
+	require.NoError(t, wfs.MkdirAll("a/b"))
+	require.NoError(t, wfs.MkdirAll("a/b"))
+	require.NoError(t, wfs.Rename("file", "a/b/renamed"))
+	require.NoError(t, wfs.Chtimes("a/b/renamed", mirrorTime, mirrorTime))
+	st, err := os.Stat(filepath.Join(dir, "a", "b", "renamed"))
+	require.NoError(t, err)
+	assert.True(t, st.ModTime().Equal(mirrorTime))
+
+	require.NoError(t, wfs.RemoveAll("a"))
+	require.NoError(t, wfs.RemoveAll("missing"))
+	assert.NoDirExists(t, filepath.Join(dir, "a"))
+
+	_, err = wfs.Create("../escape")
+	assert.True(t, errors.Is(err, os.ErrInvalid))
+}
+
+func TestValidName(t *testing.T) {
+	for name, valid := range map[string]bool{
+		".":      true,
+		"a":      true,
+		"a/b":    true,
+		"":       false,
+		"/a":     false,
+		"a/":     false,
+		"a//b":   false,
+		"a/../b": false,
+		"./a":    false,
+		`a\b`:    false,
+	} {
+		assert.Equal(t, valid, validName(name), name)
+	}
+}
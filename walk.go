@@ -0,0 +1,409 @@
+package ftp
+
+import (
+	"context"
+	"errors"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SkipDir is returned by a WalkFunc to skip a directory. When returned for a
+// file, the remaining files of its directory are skipped.
+var SkipDir = errors.New("skip this directory")
+
+// WalkFunc is the function called for each file or directory visited by
+// ServerConn.WalkDir or Pool.Walk, with its path starting with the root of
+// the walk.
+//
+// It is called a first time for each directory with a nil error. If the
+// listing of the directory then fails, for example with ErrPermissionDenied,
+// it is called a second time with the error: returning nil or SkipDir goes on
+// with the walk, any other error stops it.
+type WalkFunc func(path string, entry *Entry, err error) error
+
+// WalkOption represents an option of Pool.Walk
+type WalkOption struct {
+	setup func(wo *walkOptions)
+}
+
+// walkOptions contains all the options set by WalkOption.setup
+type walkOptions struct {
+	concurrency int
+	ordered     bool
+}
+
+// WalkWithConcurrency returns a WalkOption that configures the number of
+// directories listed at the same time, each over its own connection of the
+// Pool. The default is 4.
+func WalkWithConcurrency(n int) WalkOption {
+	return WalkOption{func(wo *walkOptions) {
+		wo.concurrency = n
+	}}
+}
+
+// WalkWithOrder returns a WalkOption that configures whether the files are
+// visited in lexical order, depth first, as by a sequential walk. Otherwise
+// the directories are visited as soon as they are listed.
+//
+// To keep the connections busy, the ordered walk lists the directories before
+// they are visited, so a directory skipped with SkipDir may have been listed.
+func WalkWithOrder(enabled bool) WalkOption {
+	return WalkOption{func(wo *walkOptions) {
+		wo.ordered = enabled
+	}}
+}
+
+// WalkDir walks the remote file tree rooted at root, calling fn for each file
+// or directory in lexical order, root included. Unlike Walker, a directory
+// whose listing fails is reported to fn and the walk goes on with the
+// following files.
+//
+// The walk stops when fn returns an error other than SkipDir, which is then
+// returned. It also stops when the connection is broken, for example after a
+// 421 reply or a network error, as the following directories could not be
+// listed: the error of the listing is then returned without calling fn.
+func (c *ServerConn) WalkDir(root string, fn WalkFunc) error {
+	err := c.walkDir(root, &Entry{Name: path.Base(root), Type: EntryTypeFolder}, fn)
+	if err == SkipDir {
+		return nil
+	}
+	return err
+}
+
+// walkDir walks the directory. It returns SkipDir if fn skipped it.
+func (c *ServerConn) walkDir(dir string, entry *Entry, fn WalkFunc) error {
+	if err := fn(dir, entry, nil); err != nil {
+		return err
+	}
+
+	entries, err := c.List(dir)
+	if err != nil {
+		if c.isBroken() {
+			return err
+		}
+		if err = fn(dir, entry, err); err != nil && err != SkipDir {
+			return err
+		}
+		return nil
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+
+	for _, child := range entries {
+		if child.Name == "." || child.Name == ".." {
+			continue
+		}
+
+		p := path.Join(dir, child.Name)
+		if child.Type == EntryTypeFolder {
+			err = c.walkDir(p, child, fn)
+		} else {
+			err = fn(p, child, nil)
+		}
+		switch {
+		case err == SkipDir && child.Type == EntryTypeFolder:
+		case err == SkipDir:
+			return nil
+		case err != nil:
+			return err
+		}
+	}
+	return nil
+}
+
+// walkListing is the listing of a directory by a worker of Pool.Walk
+type walkListing struct {
+	dir     string
+	entries []*Entry // sorted by name, without "." and ".."
+	err     error
+	noConn  bool // no connection could be checked out to list dir
+}
+
+// poolWalk is a walk in progress, see Pool.Walk
+type poolWalk struct {
+	ctx  context.Context
+	pool *Pool
+	fn   WalkFunc
+
+	jobs     chan string
+	results  chan walkListing
+	queue    []string // directories to list
+	inflight int      // directories being listed
+
+	// Used by the ordered walk
+	listings map[string]walkListing // listings not visited yet
+	skipped  map[string]bool        // directories skipped
+}
+
+// Walk walks the remote file tree rooted at root like ServerConn.WalkDir, but
+// the directories are listed concurrently over several connections of the
+// Pool. fn is called for each file or directory, from a single goroutine.
+//
+// The walk stops when fn returns an error other than SkipDir, which is then
+// returned, when no connection can be checked out of the Pool, or when ctx
+// is done.
+func (p *Pool) Walk(ctx context.Context, root string, fn WalkFunc, options ...WalkOption) error {
+	wo := &walkOptions{concurrency: 4}
+	for _, option := range options {
+		option.setup(wo)
+	}
+	if wo.concurrency < 1 {
+		wo.concurrency = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := &poolWalk{
+		ctx:      ctx,
+		pool:     p,
+		fn:       fn,
+		jobs:     make(chan string),
+		results:  make(chan walkListing, wo.concurrency),
+		listings: make(map[string]walkListing),
+		skipped:  make(map[string]bool),
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < wo.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dir := range w.jobs {
+				w.results <- w.list(dir)
+			}
+		}()
+	}
+	defer func() {
+		cancel()
+		close(w.jobs)
+		for ; w.inflight > 0; w.inflight-- {
+			<-w.results
+		}
+		wg.Wait()
+	}()
+
+	rootEntry := &Entry{Name: path.Base(root), Type: EntryTypeFolder}
+	if err := fn(root, rootEntry, nil); err != nil {
+		if err == SkipDir {
+			return nil
+		}
+		return err
+	}
+
+	w.queue = append(w.queue, root)
+	if wo.ordered {
+		return w.walkOrdered(root, rootEntry)
+	}
+	return w.walkUnordered(rootEntry)
+}
+
+// list lists the directory over a connection of the Pool
+func (w *poolWalk) list(dir string) walkListing {
+	c, err := w.pool.Get(w.ctx)
+	if err != nil {
+		return walkListing{dir: dir, err: err, noConn: true}
+	}
+	entries, err := c.ListContext(w.ctx, dir)
+	w.pool.Put(c)
+	if err != nil {
+		return walkListing{dir: dir, err: err}
+	}
+
+	filtered := entries[:0]
+	for _, entry := range entries {
+		if entry.Name != "." && entry.Name != ".." {
+			filtered = append(filtered, entry)
+		}
+	}
+	sort.Slice(filtered, func(i, j int) bool {
+		return filtered[i].Name < filtered[j].Name
+	})
+	return walkListing{dir: dir, entries: filtered}
+}
+
+// next dispatches the queued directories to the workers until a listing is
+// received
+func (w *poolWalk) next() (walkListing, error) {
+	for {
+		var jobs chan string
+		var dir string
+		if len(w.queue) > 0 {
+			jobs, dir = w.jobs, w.queue[0]
+		}
+
+		select {
+		case jobs <- dir:
+			w.queue = w.queue[1:]
+			w.inflight++
+		case l := <-w.results:
+			w.inflight--
+			return l, nil
+		case <-w.ctx.Done():
+			return walkListing{}, w.ctx.Err()
+		}
+	}
+}
+
+// listingError calls fn for a directory whose listing failed. The walk stops
+// if no connection could be checked out.
+func (w *poolWalk) listingError(l walkListing, entry *Entry) error {
+	if l.noConn {
+		return l.err
+	}
+	if err := w.fn(l.dir, entry, l.err); err != nil && err != SkipDir {
+		return err
+	}
+	return nil
+}
+
+func (w *poolWalk) walkUnordered(rootEntry *Entry) error {
+	// The entries of the directories are kept until they are listed
+	entries := map[string]*Entry{w.queue[0]: rootEntry}
+
+	for len(w.queue) > 0 || w.inflight > 0 {
+		l, err := w.next()
+		if err != nil {
+			return err
+		}
+
+		entry := entries[l.dir]
+		delete(entries, l.dir)
+		if l.err != nil {
+			if err = w.listingError(l, entry); err != nil {
+				return err
+			}
+			continue
+		}
+
+		for _, entry := range l.entries {
+			p := path.Join(l.dir, entry.Name)
+			err = w.fn(p, entry, nil)
+			if err == SkipDir {
+				if entry.Type == EntryTypeFolder {
+					continue
+				}
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if entry.Type == EntryTypeFolder {
+				entries[p] = entry
+				w.queue = append(w.queue, p)
+			}
+		}
+	}
+	return nil
+}
+
+// frame is a directory being visited by walkOrdered
+type frame struct {
+	dir     string
+	entry   *Entry
+	entries []*Entry
+	listed  bool
+}
+
+func (w *poolWalk) walkOrdered(root string, rootEntry *Entry) error {
+	stack := []*frame{{dir: root, entry: rootEntry}}
+
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+
+		if !top.listed {
+			l, err := w.wait(top.dir)
+			if err != nil {
+				return err
+			}
+			if l.err != nil {
+				stack = stack[:len(stack)-1]
+				if err = w.listingError(l, top.entry); err != nil {
+					return err
+				}
+				continue
+			}
+			top.entries, top.listed = l.entries, true
+		}
+
+		if len(top.entries) == 0 {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		entry := top.entries[0]
+		top.entries = top.entries[1:]
+
+		p := path.Join(top.dir, entry.Name)
+		err := w.fn(p, entry, nil)
+		switch {
+		case err == SkipDir && entry.Type == EntryTypeFolder:
+			w.skip(p)
+		case err == SkipDir:
+			for _, entry := range top.entries {
+				if entry.Type == EntryTypeFolder {
+					w.skip(path.Join(top.dir, entry.Name))
+				}
+			}
+			stack = stack[:len(stack)-1]
+		case err != nil:
+			return err
+		case entry.Type == EntryTypeFolder:
+			stack = append(stack, &frame{dir: p, entry: entry})
+		}
+	}
+	return nil
+}
+
+// wait returns the listing of the directory, listing the following ones
+// in the meantime
+func (w *poolWalk) wait(dir string) (walkListing, error) {
+	for {
+		if l, ok := w.listings[dir]; ok {
+			delete(w.listings, dir)
+			return l, nil
+		}
+
+		l, err := w.next()
+		if err != nil {
+			return l, err
+		}
+		if w.isSkipped(l.dir) {
+			continue
+		}
+
+		w.listings[l.dir] = l
+		for _, entry := range l.entries {
+			if entry.Type == EntryTypeFolder {
+				w.queue = append(w.queue, path.Join(l.dir, entry.Name))
+			}
+		}
+	}
+}
+
+// skip drops the listing of the directory, which may have been received
+// already, and those of its subdirectories
+func (w *poolWalk) skip(dir string) {
+	w.skipped[dir] = true
+	for p := range w.listings {
+		if p == dir || strings.HasPrefix(p, dir+"/") {
+			delete(w.listings, p)
+		}
+	}
+}
+
+// isSkipped reports whether the directory or one of its parents was skipped
+func (w *poolWalk) isSkipped(dir string) bool {
+	for {
+		if w.skipped[dir] {
+			return true
+		}
+		parent := path.Dir(dir)
+		if parent == dir {
+			return false
+		}
+		dir = parent
+	}
+}
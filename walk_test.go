@@ -0,0 +1,164 @@
+package ftp
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// walkTree are the calls of the WalkFunc for the tree under /walk, in order
+var walkTree = []string{
+	"/walk",
+	"/walk/a",
+	"/walk/a/a1",
+	"/walk/a/sub",
+	"/walk/a/sub/s1",
+	"/walk/b",
+	"/walk/b/b1",
+	"/walk/b/b2",
+	"/walk/denied",
+	"/walk/denied: error",
+	"/walk/file",
+}
+
+// recordWalk returns a WalkFunc recording its calls into visited
+func recordWalk(visited *[]string, fn WalkFunc) WalkFunc {
+	return func(path string, entry *Entry, err error) error {
+		if err != nil {
+			*visited = append(*visited, path+": error")
+		} else {
+			*visited = append(*visited, path)
+		}
+		if fn == nil {
+			return nil
+		}
+		return fn(path, entry, err)
+	}
+}
+
+func TestPoolWalkOrdered(t *testing.T) {
+	p := newTestPool(t)
+	defer p.Close()
+
+	var visited []string
+	err := p.Walk(context.Background(), "/walk", recordWalk(&visited, func(path string, entry *Entry, err error) error {
+		if path == "/walk/denied" && err != nil {
+			assert.True(t, errors.Is(err, ErrPermissionDenied))
+			assert.Equal(t, EntryTypeFolder, entry.Type)
+			assert.Equal(t, "denied", entry.Name)
+		}
+		return nil
+	}), WalkWithConcurrency(3), WalkWithOrder(true))
+	require.NoError(t, err)
+	assert.Equal(t, walkTree, visited)
+}
+
+func TestPoolWalkUnordered(t *testing.T) {
+	p := newTestPool(t)
+	defer p.Close()
+
+	var visited []string
+	err := p.Walk(context.Background(), "/walk", recordWalk(&visited, nil), WalkWithConcurrency(3))
+	require.NoError(t, err)
+
+	// The parents are visited before their content
+	for i, path := range visited {
+		for _, parent := range visited[i+1:] {
+			assert.False(t, strings.HasPrefix(path, parent+"/"), "%s visited after %s", parent, path)
+		}
+	}
+
+	sort.Strings(visited)
+	assert.Equal(t, walkTree, visited)
+}
+
+func TestPoolWalkSkipDir(t *testing.T) {
+	for _, ordered := range []bool{false, true} {
+		p := newTestPool(t)
+
+		var visited []string
+		err := p.Walk(context.Background(), "/walk", recordWalk(&visited, func(path string, entry *Entry, err error) error {
+			switch path {
+			case "/walk/a", "/walk/b/b1":
+				return SkipDir
+			}
+			return err
+		}), WalkWithOrder(ordered))
+		assert.True(t, errors.Is(err, ErrPermissionDenied), "ordered: %v", ordered)
+
+		if ordered {
+			assert.Equal(t, []string{"/walk", "/walk/a", "/walk/b", "/walk/b/b1", "/walk/denied", "/walk/denied: error"}, visited)
+		} else {
+			assert.NotContains(t, visited, "/walk/a/a1")
+			assert.NotContains(t, visited, "/walk/b/b2")
+		}
+		p.Close()
+	}
+}
+
+func TestPoolWalkSkipRoot(t *testing.T) {
+	p := newTestPool(t)
+	defer p.Close()
+
+	var visited []string
+	err := p.Walk(context.Background(), "/walk", recordWalk(&visited, func(string, *Entry, error) error {
+		return SkipDir
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/walk"}, visited)
+}
+
+func TestWalkDir(t *testing.T) {
+	_, c := dialTestMirror(t)
+
+	var visited []string
+	err := c.WalkDir("/walk", recordWalk(&visited, func(path string, entry *Entry, err error) error {
+		if err != nil {
+			assert.True(t, errors.Is(err, ErrPermissionDenied))
+			assert.Equal(t, "/walk/denied", path)
+		}
+		return nil
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, walkTree, visited)
+
+	visited = nil
+	err = c.WalkDir("/walk", recordWalk(&visited, func(path string, entry *Entry, err error) error {
+		switch path {
+		case "/walk/a", "/walk/b/b1":
+			return SkipDir
+		}
+		return err
+	}))
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+	assert.Equal(t, []string{"/walk", "/walk/a", "/walk/b", "/walk/b/b1", "/walk/denied", "/walk/denied: error"}, visited)
+
+	require.NoError(t, c.Quit())
+}
+
+func TestWalkDirBroken(t *testing.T) {
+	_, c := dialTestMirror(t)
+
+	var visited []string
+	err := c.WalkDir("/broken", recordWalk(&visited, nil))
+	assert.True(t, errors.Is(err, ErrServiceUnavailable))
+	assert.Equal(t, []string{"/broken", "/broken/a"}, visited)
+
+	c.Quit()
+}
+
+func TestPoolWalkNoConnection(t *testing.T) {
+	p := newTestPool(t)
+	require.NoError(t, p.Close())
+
+	// the walk stops rather than reporting every directory
+	var visited []string
+	err := p.Walk(context.Background(), "/walk", recordWalk(&visited, nil))
+	assert.Error(t, err)
+	assert.Equal(t, []string{"/walk"}, visited)
+}
@@ -0,0 +1,113 @@
+package ftp
+
+import (
+	"context"
+	"io"
+	"net"
+)
+
+// uploadWriter is the io.WriteCloser returned by StorWriter and AppendWriter
+type uploadWriter struct {
+	conn   net.Conn
+	c      *ServerConn
+	n      int64
+	closed bool
+	end    func(*error) // ends the operation started by StorWriterContext
+}
+
+// StorWriter issues a STOR FTP command and returns the data connection as an
+// io.WriteCloser, to store the file with the data written to it. This lets
+// encoders stream straight to the server, where Stor would need an io.Pipe.
+//
+// The returned io.WriteCloser must be closed to finish the upload: Close
+// returns the error of the final reply of the server. It also implements
+// Abort() error, which stops the upload with ABOR instead.
+func (c *ServerConn) StorWriter(path string) (io.WriteCloser, error) {
+	return c.StorWriterContext(context.Background(), path)
+}
+
+// StorWriterContext is like StorWriter but the transfer is interrupted when
+// ctx is done.
+//
+// The context is watched until the returned io.WriteCloser is closed.
+func (c *ServerConn) StorWriterContext(ctx context.Context, path string) (io.WriteCloser, error) {
+	return c.openWriter(ctx, "STOR %s", path)
+}
+
+// AppendWriter is like StorWriter but it issues an APPE FTP command: the
+// data is appended to the file if it already exists.
+func (c *ServerConn) AppendWriter(path string) (io.WriteCloser, error) {
+	return c.AppendWriterContext(context.Background(), path)
+}
+
+// AppendWriterContext is like AppendWriter but the transfer is interrupted
+// when ctx is done.
+//
+// The context is watched until the returned io.WriteCloser is closed.
+func (c *ServerConn) AppendWriterContext(ctx context.Context, path string) (io.WriteCloser, error) {
+	return c.openWriter(ctx, "APPE %s", path)
+}
+
+func (c *ServerConn) openWriter(ctx context.Context, format, path string) (io.WriteCloser, error) {
+	end, err := c.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := c.cmdDataConnFrom(0, format, path)
+	if err != nil {
+		end(&err)
+		return nil, err
+	}
+
+	return &uploadWriter{conn: conn, c: c, end: end}, nil
+}
+
+// Write implements the io.Writer interface on a FTP data connection.
+func (w *uploadWriter) Write(buf []byte) (int, error) {
+	n, err := w.conn.Write(buf)
+	w.n += int64(n)
+	return n, err
+}
+
+// Close implements the io.Closer interface on a FTP data connection: it ends
+// the upload and returns the error of the final reply of the server.
+// After the first call, Close will do nothing and return nil.
+func (w *uploadWriter) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	// Let the context recovery abort the transfer
+	if w.c.isInterrupted() {
+		err := w.c.context().Err()
+		endTransfer(w.conn, err)
+		w.end(&err)
+		return err
+	}
+
+	_, err := w.c.finishUpload(w.conn, w.n, nil)
+	endTransfer(w.conn, err)
+	w.end(&err)
+	return err
+}
+
+// Abort stops the upload before its end with ABOR, see Response.Abort.
+// After the first call, Abort and Close will do nothing and return nil.
+func (w *uploadWriter) Abort() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	w.c.setDataConn(nil)
+	err := w.c.abort(w.conn)
+	if err != nil {
+		endTransfer(w.conn, err)
+	} else {
+		endTransfer(w.conn, ErrTransferAborted)
+	}
+	w.end(&err)
+	return err
+}
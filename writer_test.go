@@ -0,0 +1,96 @@
+package ftp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorWriter(t *testing.T) {
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second))
+
+	w, err := c.StorWriter("test")
+	require.NoError(t, err)
+	_, err = io.WriteString(w, testData[:5])
+	require.NoError(t, err)
+	_, err = io.WriteString(w, testData[5:])
+	require.NoError(t, err)
+
+	// the upload is not over yet
+	_, err = c.FileSize("magic-file")
+	assert.Equal(t, ErrConnBusy, err)
+
+	require.NoError(t, w.Close())
+	require.NoError(t, w.Close())
+	assert.Equal(t, testData, mock.fileCont.String())
+
+	w, err = c.AppendWriter("test")
+	require.NoError(t, err)
+	_, err = io.WriteString(w, "appended")
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.Equal(t, testData+"appended", mock.fileCont.String())
+
+	closeConn(t, mock, c, []string{"EPSV", "STOR", "EPSV", "APPE"})
+}
+
+func TestStorWriterEmpty(t *testing.T) {
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second))
+
+	w, err := c.StorWriter("test")
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.Equal(t, 0, mock.fileCont.Len())
+
+	closeConn(t, mock, c, []string{"EPSV", "STOR"})
+}
+
+func TestStorWriterAbort(t *testing.T) {
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second))
+
+	w, err := c.StorWriter("test")
+	require.NoError(t, err)
+	_, err = io.WriteString(w, testData)
+	require.NoError(t, err)
+
+	aborter, ok := w.(interface{ Abort() error })
+	require.True(t, ok)
+	require.NoError(t, aborter.Abort())
+	require.NoError(t, w.Close())
+
+	// the control connection is in sync
+	size, err := c.FileSize("magic-file")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), size)
+
+	closeConn(t, mock, c, []string{"EPSV", "STOR", "ABOR", "SIZE"})
+}
+
+func TestStorWriterContextCanceled(t *testing.T) {
+	mock, c := openConn(t, "127.0.0.1", DialWithTimeout(5*time.Second))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w, err := c.StorWriterContext(ctx, "test")
+	require.NoError(t, err)
+	_, err = io.WriteString(w, testData)
+	require.NoError(t, err)
+
+	// the writes fail once the context is done
+	cancel()
+	for err == nil {
+		_, err = io.WriteString(w, testData)
+	}
+	assert.True(t, errors.Is(w.Close(), context.Canceled))
+
+	// the control connection was recovered
+	size, err := c.FileSize("magic-file")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), size)
+
+	closeConn(t, mock, c, []string{"EPSV", "STOR", "ABOR", "SIZE"})
+}